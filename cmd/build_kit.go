@@ -1,20 +1,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
 	"github.com/zj-sh/mrd/util"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
-)
-
-const (
-	DefaultKitDist     = "kit"
-	DefaultKitMainFile = "kit.sh"
+	"sync"
 )
 
 type buildKitOpts struct {
@@ -37,41 +34,44 @@ func newBuildKitCmd(opts *buildOpts) *buildKitCmd {
   - kit.sh
   - Mored.yaml
   - ...`,
-		Run: func(cmd *cobra.Command, includes []string) {
+		RunE: func(cmd *cobra.Command, includes []string) error {
+			if err := c.checkDigest(); err != nil {
+				return err
+			}
 			paths := c.search(includes)
-			charts := c.parse(paths)
-			index := c.build(charts)
+			charts, err := c.parse(paths)
+			if err != nil {
+				return err
+			}
+			index, err := c.build(charts)
+			if err != nil {
+				return err
+			}
 			if c.buildOpts.push {
-				c.push(index)
+				c.publish(mored.DefaultKitDist, index.Kits)
 			}
+			return c.partial()
 		},
 	}
 	return c
 }
 
 type kitInfo struct {
-	Src   string
-	Chart *Chart
+	Src    string
+	Chart  *mored.Chart
+	Ignore *util.Ignore
 }
 
-func (c *buildKitCmd) kit(dir string) (*Chart, error) {
-	chart, err := c.readChart(path.Join(dir, DefaultChartFile))
+func (c *buildKitCmd) kit(dir string) (*kitInfo, error) {
+	chart, ignore, err := mored.LoadChart(mored.DefaultKitDist, dir, c.store.Remote(), c.store.remotes())
 	if err != nil {
-		return nil, fmt.Errorf("load Mored.yaml failed. %s", err.Error())
-	}
-	if err = c.verifyMust(chart); err != nil {
 		return nil, err
 	}
-	return &Chart{
-		Name:         chart.Name,
-		FullName:     util.FirstTruthValue(chart.FullName, chart.Name),
-		Version:      chart.Version,
-		MoredVersion: util.FirstTruthValue(chart.MoredVersion, ">=0.0.0"),
-		Os:           util.FirstTruthValue(chart.Os, []string{"linux", "darwin"}),
-		Arch:         util.FirstTruthValue(chart.Arch, []string{"amd64", "arm64"}),
-		DepKits:      chart.DepKits,
-		Metadata:     chart.Metadata,
-	}, nil
+	return &kitInfo{Src: dir, Chart: chart, Ignore: ignore}, nil
+}
+func (c *buildOpts) kitChart(chart *mored.Chart) (*mored.Chart, error) {
+	mored.ResolveRemotes(chart, c.store.remotes())
+	return mored.KitChart(chart, c.store.Remote())
 }
 func (c *buildKitCmd) search(includes []string) []string {
 	var paths []string
@@ -80,8 +80,8 @@ func (c *buildKitCmd) search(includes []string) []string {
 			if !fi.IsDir() {
 				return nil
 			}
-			main := path.Join(dir, DefaultKitMainFile)
-			chart := path.Join(dir, DefaultChartFile)
+			main := path.Join(dir, mored.DefaultKitMainFile)
+			chart := path.Join(dir, mored.DefaultChartFile)
 			if !util.IsExisted(main) || !util.IsExisted(chart) {
 				return nil
 			}
@@ -105,63 +105,60 @@ func (c *buildKitCmd) search(includes []string) []string {
 	})
 	return paths
 }
-func (c *buildKitCmd) parse(paths []string) map[string]*kitInfo {
+func (c *buildKitCmd) parse(paths []string) (map[string]*kitInfo, error) {
 	var charts = make(map[string]*kitInfo)
+	var failed error
 	c.do("parsing kits...", func() {
 		for _, p := range paths {
-			chart, err := c.kit(p)
+			info, err := c.kit(p)
 			if err != nil {
-				c.warn("%s: %s", p, err.Error())
+				if err = c.failure(p, validationError("%w", err)); err != nil {
+					failed = err
+					return
+				}
 				continue
 			}
-			if _, ok := charts[chart.Name]; ok {
-				c.warn("kit %s is exist %s %s", p, chart.Name, chart.Version)
+			if _, ok := charts[info.Chart.Name]; ok {
+				if err = c.failure(p, validationError("kit %s %s is exist", info.Chart.Name, info.Chart.Version)); err != nil {
+					failed = err
+					return
+				}
 				continue
 			}
-			charts[chart.Name] = &kitInfo{Src: p, Chart: chart}
+			charts[info.Chart.Name] = info
 		}
 	})
-	return charts
+	return charts, failed
 }
-func (c *buildKitCmd) build(charts map[string]*kitInfo) *Index {
-	index := c.index()
+func (c *buildKitCmd) build(charts map[string]*kitInfo) (*mored.Index, error) {
+	index := mored.NewIndex()
+	var failed error
 	c.do("building kits...", func() {
-		dist := path.Join(c.dist, DefaultKitDist)
-		_ = os.RemoveAll(dist)
+		dist := path.Join(c.dist, mored.DefaultKitDist)
 		_ = os.MkdirAll(dist, os.ModePerm)
+		var items []*kitInfo
 		for _, cf := range charts {
-			chart := cf.Chart
-			gzName := c.chartFileName(chart.Name, chart.Version)
-			gzFile := path.Join(dist, fmt.Sprintf("%s.tar.gz", gzName))
-			if err := util.Compress(cf.Src, gzFile); err != nil {
-				c.warn("%s build failed: %s", cf.Src, err.Error())
-			} else {
-				if chart.Metadata == nil {
-					chart.Metadata = &Metadata{}
-				}
-				chart.Metadata.Digest = util.FileDigest(gzFile)
-				chart.Metadata.Generated = time.Now()
-				c.success("%s build success %s digest:%s", cf.Src, gzFile, chart.Metadata.Digest)
-				index.Kits[chart.Name] = append(index.Kits[chart.Name], chart)
-			}
+			items = append(items, cf)
 		}
-		c.success("build kits success!")
-	})
-	return &index
-}
-func (c *buildKitCmd) push(index *Index) {
-	dist := path.Join(c.dist, DefaultKitDist)
-	c.do("pushing kits...", func() {
-		c.oss.Load()
-		for _, charts := range index.Kits {
-			for _, chart := range charts {
-				gzName := c.chartFileName(chart.Name, chart.Version)
-				gzFile := path.Join(dist, fmt.Sprintf("%s.tar.gz", gzName))
-				c.oss.Upload(DefaultKitDist, gzFile)
-				c.info("%s success!", chart.Name)
+		var mu sync.Mutex
+		cache := c.loadCache()
+		util.Parallel(c.jobs, items, func(cf *kitInfo) {
+			if err := c.archive(mored.DefaultKitDist, cf.Src, cf.Ignore, cf.Chart, cache); err != nil {
+				if err = c.failure(cf.Src, fmt.Errorf("build failed: %w", err)); err != nil {
+					mu.Lock()
+					failed = errors.Join(failed, err)
+					mu.Unlock()
+				}
+				return
 			}
+			mu.Lock()
+			index.Kits[cf.Chart.Name] = append(index.Kits[cf.Chart.Name], cf.Chart)
+			mu.Unlock()
+		})
+		c.saveCache(cache)
+		if failed == nil {
+			c.success("build kits success!")
 		}
-		c.mergeIndex(index.Kits, nil)
-		c.success("push success!")
 	})
+	return index, failed
 }
@@ -1,23 +1,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
 	"github.com/zj-sh/mrd/util"
-	"github.com/zohu/reg"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
-)
-
-const (
-	DefaultSuiteDist           = "suite"
-	DefaultSuiteMainFile       = "suite"
-	DefaultSuitePattern        = `^suite(\.\w+)?$`
-	DefaultSuiteCommandPattern = `(^@$)|(^@\x20.*)|(.*\x20@$)|(.*\x20@\x20.*)`
+	"sync"
 )
 
 type suiteOpts struct {
@@ -39,50 +33,44 @@ func newSuiteCmd(opts *buildOpts) *suiteCmd {
   - suite [suite.jar] [suite.py] [suite.sh] [suite.exe] [suite.js]
   - Mored.yaml
   - ...`,
-		Run: func(cmd *cobra.Command, includes []string) {
+		RunE: func(cmd *cobra.Command, includes []string) error {
+			if err := c.checkDigest(); err != nil {
+				return err
+			}
 			paths := c.search(includes)
-			charts := c.parse(paths)
-			index := c.build(charts)
+			charts, err := c.parse(paths)
+			if err != nil {
+				return err
+			}
+			index, err := c.build(charts)
+			if err != nil {
+				return err
+			}
 			if c.buildOpts.push {
-				c.push(index)
+				c.publish(mored.DefaultSuiteDist, index.Suites)
 			}
+			return c.partial()
 		},
 	}
 	return c
 }
 
 type suiteInfo struct {
-	Src   string
-	Chart *Chart
+	Src    string
+	Chart  *mored.Chart
+	Ignore *util.Ignore
 }
 
-func (c *suiteCmd) suite(dir string) (*Chart, error) {
-	chart, err := c.readChart(path.Join(dir, DefaultChartFile))
+func (c *suiteCmd) suite(dir string) (*suiteInfo, error) {
+	chart, ignore, err := mored.LoadChart(mored.DefaultSuiteDist, dir, c.store.Remote(), c.store.remotes())
 	if err != nil {
-		return nil, fmt.Errorf("load Mored.yaml failed. %s", err.Error())
-	}
-	if err = c.verifyMust(chart); err != nil {
 		return nil, err
 	}
-	if reg.String(chart.Command).Match(DefaultSuiteCommandPattern).AllowZero().NotB() {
-		return nil, fmt.Errorf("command must not contain the @ symbol")
-	}
-	if len(chart.Effects) == 0 {
-		return nil, fmt.Errorf("effects is required")
-	}
-	return &Chart{
-		Name:         chart.Name,
-		FullName:     util.FirstTruthValue(chart.FullName, chart.Name),
-		Version:      chart.Version,
-		MoredVersion: util.FirstTruthValue(chart.MoredVersion, ">=0.0.0"),
-		Command:      util.FirstTruthValue(chart.Command, "@"),
-		Effects:      chart.Effects,
-		Os:           util.FirstTruthValue(chart.Os, []string{"linux", "darwin"}),
-		Arch:         util.FirstTruthValue(chart.Arch, []string{"amd64", "arm64"}),
-		DepKits:      chart.DepKits,
-		DepSuites:    chart.DepSuites,
-		Metadata:     chart.Metadata,
-	}, nil
+	return &suiteInfo{Src: dir, Chart: chart, Ignore: ignore}, nil
+}
+func (c *buildOpts) suiteChart(chart *mored.Chart) (*mored.Chart, error) {
+	mored.ResolveRemotes(chart, c.store.remotes())
+	return mored.SuiteChart(chart, c.store.Remote())
 }
 func (c *suiteCmd) search(includes []string) []string {
 	var paths []string
@@ -91,10 +79,10 @@ func (c *suiteCmd) search(includes []string) []string {
 			if !fi.IsDir() {
 				return nil
 			}
-			if !util.IsExisted(path.Join(dir, DefaultChartFile)) {
+			if !util.IsExisted(path.Join(dir, mored.DefaultChartFile)) {
 				return nil
 			}
-			if !util.HasPatternFile(dir, DefaultSuitePattern) {
+			if !util.HasPatternFile(dir, mored.DefaultSuitePattern) {
 				return nil
 			}
 			if len(includes) > 0 {
@@ -117,63 +105,60 @@ func (c *suiteCmd) search(includes []string) []string {
 	})
 	return paths
 }
-func (c *suiteCmd) parse(paths []string) map[string]*suiteInfo {
+func (c *suiteCmd) parse(paths []string) (map[string]*suiteInfo, error) {
 	suites := make(map[string]*suiteInfo)
+	var failed error
 	c.do("parsing suites...", func() {
 		for _, p := range paths {
-			chart, err := c.suite(p)
+			info, err := c.suite(p)
 			if err != nil {
-				c.warn("%s: %s", p, err.Error())
+				if err = c.failure(p, validationError("%w", err)); err != nil {
+					failed = err
+					return
+				}
 				continue
 			}
-			if _, ok := suites[chart.Name]; ok {
-				c.warn("suite %s is exist %s %s", p, chart.Name, chart.Version)
+			if _, ok := suites[info.Chart.Name]; ok {
+				if err = c.failure(p, validationError("suite %s %s is exist", info.Chart.Name, info.Chart.Version)); err != nil {
+					failed = err
+					return
+				}
 				continue
 			}
-			suites[p] = &suiteInfo{Src: p, Chart: chart}
+			suites[info.Chart.Name] = info
 		}
 	})
-	return suites
+	return suites, failed
 }
-func (c *suiteCmd) build(suites map[string]*suiteInfo) *Index {
-	index := c.index()
+func (c *suiteCmd) build(suites map[string]*suiteInfo) (*mored.Index, error) {
+	index := mored.NewIndex()
+	var failed error
 	c.do("building suites...", func() {
-		dist := path.Join(c.dist, DefaultSuiteDist)
-		_ = os.RemoveAll(dist)
+		dist := path.Join(c.dist, mored.DefaultSuiteDist)
 		_ = os.MkdirAll(dist, os.ModePerm)
+		var items []*suiteInfo
 		for _, cf := range suites {
-			chart := cf.Chart
-			gzName := c.chartFileName(chart.Name, chart.Version)
-			gzFile := path.Join(dist, fmt.Sprintf("%s.tar.gz", gzName))
-			if err := util.Compress(cf.Src, gzFile); err != nil {
-				c.warn("%s build failed: %s", cf.Src, err.Error())
-			} else {
-				if chart.Metadata == nil {
-					chart.Metadata = &Metadata{}
-				}
-				chart.Metadata.Digest = util.FileDigest(gzFile)
-				chart.Metadata.Generated = time.Now()
-				c.success("%s build success %s digest:%s", cf.Src, gzFile, chart.Metadata.Digest)
-				index.Suites[chart.Name] = append(index.Suites[chart.Name], chart)
-			}
+			items = append(items, cf)
 		}
-		c.success("build suites success")
-	})
-	return &index
-}
-func (c *suiteCmd) push(index *Index) {
-	dist := path.Join(c.dist, DefaultSuiteDist)
-	c.do("pushing suites...", func() {
-		c.oss.Load()
-		for _, charts := range index.Suites {
-			for _, chart := range charts {
-				gzName := c.chartFileName(chart.Name, chart.Version)
-				gzFile := path.Join(dist, fmt.Sprintf("%s.tar.gz", gzName))
-				c.oss.Upload(DefaultSuiteDist, gzFile)
-				c.info("%s success!", chart.Name)
+		var mu sync.Mutex
+		cache := c.loadCache()
+		util.Parallel(c.jobs, items, func(cf *suiteInfo) {
+			if err := c.archive(mored.DefaultSuiteDist, cf.Src, cf.Ignore, cf.Chart, cache); err != nil {
+				if err = c.failure(cf.Src, fmt.Errorf("build failed: %w", err)); err != nil {
+					mu.Lock()
+					failed = errors.Join(failed, err)
+					mu.Unlock()
+				}
+				return
 			}
+			mu.Lock()
+			index.Suites[cf.Chart.Name] = append(index.Suites[cf.Chart.Name], cf.Chart)
+			mu.Unlock()
+		})
+		c.saveCache(cache)
+		if failed == nil {
+			c.success("build suites success")
 		}
-		c.mergeIndex(nil, index.Suites)
-		c.success("push success!")
 	})
+	return index, failed
 }
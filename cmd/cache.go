@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"sync"
+)
+
+const (
+	DefaultBuildCache = ".mredcache"
+)
+
+type cachedChart struct {
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// buildCache remembers the source digest each archive in dist was built from.
+type buildCache struct {
+	mu     sync.Mutex
+	charts map[string]*cachedChart
+}
+
+func (c *buildOpts) loadCache() *buildCache {
+	cache := &buildCache{charts: make(map[string]*cachedChart)}
+	if d, err := os.ReadFile(path.Join(c.dist, DefaultBuildCache)); err == nil {
+		_ = yaml.Unmarshal(d, &cache.charts)
+	}
+	return cache
+}
+func (c *buildOpts) saveCache(cache *buildCache) {
+	d, err := yaml.Marshal(cache.charts)
+	c.hasErrExit("failed to save build cache", err)
+	c.hasErrExit("failed to save build cache", util.WriteFile(path.Join(c.dist, DefaultBuildCache), d))
+}
+func (b *buildCache) get(object string) *cachedChart {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.charts[object]
+}
+func (b *buildCache) set(object string, cached *cachedChart) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.charts[object] = cached
+}
+func (c *buildOpts) archive(kind, src string, ignore *util.Ignore, chart *mored.Chart, cache *buildCache) error {
+	object := mored.ChartObject(kind, chart)
+	gzFile := path.Join(c.dist, object)
+	source, err := util.SourceDigest(src, ignore)
+	if err != nil {
+		return err
+	}
+	status := "built"
+	if cached := cache.get(object); cached != nil && cached.Source == source &&
+		util.DigestAlgorithm(cached.Digest) == c.digest && util.VerifyDigest(gzFile, cached.Digest) == nil {
+		status = "unchanged"
+		mored.Stamp(chart, cached.Digest)
+		c.info("%s unchanged, reusing %s", src, gzFile)
+	} else {
+		excluded, err := mored.BuildArchive(kind, src, c.dist, ignore, chart, c.digest)
+		for _, name := range excluded {
+			c.info("%s excluded %s", src, name)
+		}
+		if err != nil {
+			return err
+		}
+		cache.set(object, &cachedChart{Source: source, Digest: mored.ChartDigest(chart)})
+	}
+	c.record(status, kind, chart).Path = gzFile
+	c.success("%s build success %s digest:%s", src, gzFile, mored.ChartDigest(chart))
+	return nil
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/util"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultCredentialsFile = "credentials"
+	DefaultEnvPrefix       = "MRD"
+	DefaultMask            = "******"
+)
+
+const credentialsHelp = `
+
+the key and secret are never written to the config, they are read in order from:
+  1. the environment, MRD_<SECTION>_KEY and MRD_<SECTION>_SECRET where SECTION is the upper case
+     config section with . and - replaced by _, e.g. MRD_OSS_KEY or MRD_REPOS_PROD_SECRET
+  2. a credential helper set by credential.helper or <section>.helper, it is run with "get" and
+     speaks the git credential protocol, username is the key and password the secret.
+     a helper starting with ! is a shell command, other relative names run mrd-credential-<name>
+  3. the credentials file next to the config, it must not be accessible by other users (0600),
+     --key and --secret are saved there
+  4. the config written by older versions, saving the config moves them to the credentials file`
+
+type masker struct {
+	mu      sync.Mutex
+	secrets []string
+}
+
+var secrets = &masker{}
+
+func (m *masker) add(secret string) {
+	if secret == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.secrets = append(m.secrets, secret)
+}
+func (m *masker) mask(s string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, secret := range m.secrets {
+		s = strings.ReplaceAll(s, secret, DefaultMask)
+	}
+	return s
+}
+
+// credentialEnv is the environment variable holding field of section, e.g. MRD_REPOS_PROD_KEY.
+func credentialEnv(section, field string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(section)
+	return strings.ToUpper(fmt.Sprintf("%s_%s_%s", DefaultEnvPrefix, name, field))
+}
+
+// credentials resolves the key and secret of section, host identifies the repository to credential helpers.
+func (r *rootOpts) credentials(section, host string) (string, string) {
+	key, secret := os.Getenv(credentialEnv(section, "key")), os.Getenv(credentialEnv(section, "secret"))
+	if key == "" || secret == "" {
+		if helper := viper.GetString(section + ".helper"); helper != "" || viper.GetString("credential.helper") != "" {
+			k, s, err := r.credentialHelper(helper, section, host)
+			if err != nil {
+				r.fail(configError("credential helper failed: %w", err))
+			}
+			key, secret = util.FirstTruthValue(key, k), util.FirstTruthValue(secret, s)
+		}
+	}
+	if key == "" || secret == "" {
+		creds := r.loadCredentials()
+		key = util.FirstTruthValue(key, creds.GetString(section+".key"))
+		secret = util.FirstTruthValue(secret, creds.GetString(section+".secret"))
+	}
+	// configs written by older versions keep them in plaintext
+	key = util.FirstTruthValue(key, viper.GetString(section+".key"))
+	secret = util.FirstTruthValue(secret, viper.GetString(section+".secret"))
+	secrets.add(secret)
+	return key, secret
+}
+
+// credentialHelper runs `helper get` with the git credential protocol.
+func (r *rootOpts) credentialHelper(helper, section, host string) (string, string, error) {
+	helper = util.FirstTruthValue(helper, viper.GetString("credential.helper"))
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!") && runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/C", strings.TrimPrefix(helper, "!")+" get")
+	case strings.HasPrefix(helper, "!"):
+		cmd = exec.Command("sh", "-c", strings.TrimPrefix(helper, "!")+" get")
+	case path.IsAbs(helper) || strings.ContainsAny(helper, `/\`):
+		cmd = exec.Command(helper, "get")
+	default:
+		cmd = exec.Command("mrd-credential-"+helper, "get")
+	}
+	protocol, host, ok := strings.Cut(host, "://")
+	if !ok {
+		protocol, host = "https", protocol
+	}
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", protocol, host, section))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", helper, err)
+	}
+	var key, secret string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		k, v, _ := strings.Cut(sc.Text(), "=")
+		switch k {
+		case "username":
+			key = v
+		case "password":
+			secret = v
+		}
+	}
+	return key, secret, sc.Err()
+}
+
+func (r *rootOpts) credentialsFile() string {
+	return path.Join(r.configDir(), DefaultCredentialsFile)
+}
+func (r *rootOpts) loadCredentials() *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("toml")
+	file := r.credentialsFile()
+	fi, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return v
+	}
+	r.hasErrExit("load credentials failed", err)
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		r.fail(configError("%s is accessible by other users, run chmod 600 %s", file, file))
+	}
+	v.SetConfigFile(file)
+	if err = v.ReadInConfig(); err != nil {
+		r.fail(configError("load credentials failed: %w", err))
+	}
+	return v
+}
+func (r *rootOpts) moveCredentials(settings map[string]any) {
+	sections := map[string]any{"oss": settings["oss"], "s3": settings["s3"]}
+	if repos, ok := settings[DefaultRepoSection].(map[string]any); ok {
+		for name, repo := range repos {
+			sections[repoSection(name)] = repo
+		}
+	}
+	creds := r.loadCredentials()
+	var moved bool
+	for section, m := range sections {
+		m, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"key", "secret"} {
+			if v, _ := m[field].(string); v != "" {
+				creds.Set(section+"."+field, v)
+				moved = true
+			}
+			delete(m, field)
+		}
+	}
+	if !moved {
+		return
+	}
+	r.saveCredentials(creds)
+}
+func (r *rootOpts) removeCredentials(section string) {
+	creds := r.loadCredentials()
+	if !creds.IsSet(section) {
+		return
+	}
+	settings := creds.AllSettings()
+	parent, name, _ := strings.Cut(section, ".")
+	if m, ok := settings[parent].(map[string]any); ok && name != "" {
+		delete(m, name)
+	} else {
+		delete(settings, parent)
+	}
+	fresh := viper.New()
+	fresh.SetConfigType("toml")
+	r.hasErrExit("save credentials failed", fresh.MergeConfigMap(settings))
+	r.saveCredentials(fresh)
+}
+
+// saveCredentials creates the credentials file with 0600 before anything is written to it.
+func (r *rootOpts) saveCredentials(creds *viper.Viper) {
+	file := r.credentialsFile()
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0600)
+	r.hasErrExit("save credentials failed", err)
+	_ = f.Close()
+	r.hasErrExit("save credentials failed", os.Chmod(file, 0600))
+	r.hasErrExit("save credentials failed", creds.WriteConfigAs(file))
+}
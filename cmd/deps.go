@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"slices"
+	"strings"
+)
+
+type depsOpts struct {
+	*resolveOpts
+}
+
+type depsCmd struct {
+	*depsOpts
+	cmd *cobra.Command
+}
+
+func newDepsCmd(opts *rootOpts) *depsCmd {
+	c := &depsCmd{
+		depsOpts: &depsOpts{resolveOpts: newResolveOpts(opts)},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "deps [name[@constraint]...]",
+		Short: "resolve and print the dependency tree of kits or suites.",
+		Long: `without arguments, resolve the dependencies of Mored.yaml in the chart directory
+and write the chosen versions to Mored.lock next to it.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var res *resolution
+			if len(args) > 0 {
+				_, res = c.resolve(args...)
+			} else {
+				_, res = c.lock(c.chart)
+			}
+			for _, key := range res.roots {
+				c.print(res, key, "", "", make(map[string]bool))
+			}
+			c.notice(res.order())
+			for _, rc := range res.order() {
+				out := c.record("resolved", rc.kind, rc.chart)
+				out.Remote = rc.remote
+				for _, dep := range rc.deps {
+					out.Deps = append(out.Deps, res.charts[dep].String())
+				}
+			}
+			c.success("resolved %d charts", len(res.charts))
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.chart, "chart", "", ".", "chart directory containing Mored.yaml, used without arguments.")
+	c.cmd.Flags().StringVarP(&c.kind, "kind", "k", "", "kit or suite, required when both have the same name.")
+	c.cmd.Flags().StringVarP(&c.remote, "remote", "", "", "resolve against http(s):// or file:// repository instead of the configured one.")
+	return c
+}
+
+func (c *depsOpts) print(res *resolution, key, indent, constraint string, seen map[string]bool) {
+	rc := res.charts[key]
+	line := fmt.Sprintf("%s%s", indent, rc)
+	if constraint != "" {
+		line = fmt.Sprintf("%s (%s)", line, constraint)
+	}
+	if len(res.roots) > 0 && rc.remote != res.charts[res.roots[0]].remote {
+		line = fmt.Sprintf("%s from %s", line, rc.remote)
+	}
+	if seen[key] {
+		c.info("%s *", line)
+		return
+	}
+	seen[key] = true
+	c.info(line)
+	deps := slices.Concat(rc.chart.DepKits, rc.chart.DepSuites)
+	for i, dep := range rc.deps {
+		c.print(res, dep, strings.Repeat("  ", len(indent)/2+1), deps[i].Version, seen)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zj-sh/mrd/pkg/mored"
+)
+
+// exit codes, documented in the help of the root command.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitConfig     = 2
+	ExitValidation = 3
+	ExitStorage    = 4
+	ExitPartial    = 5
+)
+
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e *codeError) Error() string {
+	return e.err.Error()
+}
+func (e *codeError) Unwrap() error {
+	return e.err
+}
+
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codeError{code: code, err: err}
+}
+func configError(format string, a ...interface{}) error {
+	return withCode(ExitConfig, fmt.Errorf(format, a...))
+}
+func validationError(format string, a ...interface{}) error {
+	return withCode(ExitValidation, fmt.Errorf(format, a...))
+}
+
+// storageError marks err as a storage failure, unless it already carries an exit code.
+func storageError(err error) error {
+	var e *codeError
+	if errors.As(err, &e) {
+		return err
+	}
+	return withCode(ExitStorage, err)
+}
+
+// exitCode maps err to an exit code, storage sentinel errors are storage errors wherever they surface.
+func exitCode(err error) int {
+	var e *codeError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &e):
+		return e.code
+	case errors.Is(err, mored.ErrPublished):
+		return ExitValidation
+	case errors.Is(err, mored.ErrObjectNotExist), errors.Is(err, mored.ErrConflict), errors.Is(err, mored.ErrIndexCorrupted):
+		return ExitStorage
+	}
+	return ExitFailure
+}
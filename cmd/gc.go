@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultKeepLast = 10
+)
+
+type gcOpts struct {
+	*buildOpts
+	keepLast       int
+	keepDays       int
+	keepReferenced bool
+}
+
+type gcCmd struct {
+	*gcOpts
+	cmd *cobra.Command
+}
+
+func newGcCmd(opts *rootOpts) *gcCmd {
+	c := &gcCmd{
+		gcOpts: &gcOpts{buildOpts: &buildOpts{rootOpts: opts, store: newStoreOpts(opts)}},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "gc [name...]",
+		Short: "remove old versions and their archives from the repository.",
+		Long: `a version is kept when any retention policy keeps it, example:
+  mrd gc --keep-last 5 --keep-days 30
+  mrd gc hello --keep-last 1 --dry-run`,
+		Run: func(cmd *cobra.Command, names []string) {
+			if c.keepLast < 1 {
+				c.exit("--keep-last must be at least 1")
+			}
+			c.store.Load()
+			index, _ := c.store.readIndex()
+			removed := c.plan(index, names)
+			if len(removed) == 0 {
+				c.success("nothing to remove")
+				return
+			}
+			for _, rc := range removed {
+				c.info("remove %s", rc)
+				c.record("removed", rc.kind, rc.chart)
+			}
+			c.do(fmt.Sprintf("removing %d versions...", len(removed)), func() {
+				author := mored.NewAuthor()
+				c.store.updateIndex(func(remote *mored.Index) {
+					removed = c.plan(remote, names)
+					for _, rc := range removed {
+						charts := remote.Charts(rc.kind)
+						name := rc.chart.Name
+						charts[name] = slices.DeleteFunc(charts[name], func(ct *mored.Chart) bool { return ct == rc.chart })
+						if len(charts[name]) == 0 {
+							delete(charts, name)
+						}
+					}
+					remote.MergeAuthor(author)
+				})
+				st := c.store.Storage()
+				for _, rc := range removed {
+					object := mored.ChartObject(rc.kind, rc.chart)
+					for _, name := range []string{object, object + mored.DefaultSignatureExt} {
+						err := st.Delete(name)
+						if err != nil && !errors.Is(err, mored.ErrObjectNotExist) {
+							c.warn("delete %s failed: %s", name, err.Error())
+						} else if err == nil {
+							c.deleted(name)
+						}
+					}
+				}
+				c.success("removed %d versions", len(removed))
+			})
+		},
+	}
+	c.cmd.Flags().IntVarP(&c.keepLast, "keep-last", "n", DefaultKeepLast, "keep the highest N versions of each name.")
+	c.cmd.Flags().IntVarP(&c.keepDays, "keep-days", "", 0, "keep versions generated within N days, 0 disables.")
+	c.cmd.Flags().BoolVarP(&c.keepReferenced, "keep-referenced", "", true, "keep versions selected by the dependencies of kept charts.")
+	return c
+}
+
+// plan lists the charts of index that no retention policy keeps, only names are considered when given.
+func (c *gcOpts) plan(index *mored.Index, names []string) []*resolvedChart {
+	remote := c.store.Remote()
+	keep := make(map[*mored.Chart]bool)
+	var queue []*resolvedChart
+	cutoff := time.Now().AddDate(0, 0, -c.keepDays)
+	for _, kind := range []string{mored.DefaultKitDist, mored.DefaultSuiteDist} {
+		charts := index.Charts(kind)
+		for name, cts := range charts {
+			sorted := slices.Clone(cts)
+			mored.SortCharts(sorted)
+			for i, ct := range sorted {
+				recent := c.keepDays > 0 && ct.Metadata != nil && ct.Metadata.Generated.After(cutoff)
+				if (len(names) > 0 && !slices.Contains(names, name)) || i < c.keepLast || recent {
+					keep[ct] = true
+					queue = append(queue, &resolvedChart{kind: kind, remote: remote, chart: ct})
+				}
+			}
+		}
+	}
+	if c.keepReferenced {
+		r := &resolver{anyPlatform: true}
+		for len(queue) > 0 {
+			rc := queue[0]
+			queue = queue[1:]
+			for _, dep := range r.dependencies(rc) {
+				if dep.remote != strings.TrimSuffix(remote, "/") {
+					continue
+				}
+				charts := index.Charts(dep.kind)
+				candidates := r.candidates(charts[dep.name], []*requirement{dep})
+				if len(candidates) > 0 && !keep[candidates[0]] {
+					keep[candidates[0]] = true
+					queue = append(queue, &resolvedChart{kind: dep.kind, remote: remote, chart: candidates[0]})
+				}
+			}
+		}
+	}
+	var removed []*resolvedChart
+	for _, kind := range []string{mored.DefaultKitDist, mored.DefaultSuiteDist} {
+		charts := index.Charts(kind)
+		for _, name := range util.SortedKeys(charts) {
+			for _, ct := range charts[name] {
+				if !keep[ct] {
+					removed = append(removed, &resolvedChart{kind: kind, remote: remote, chart: ct})
+				}
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type indexOpts struct {
+	*buildOpts
+}
+
+type indexCmd struct {
+	*indexOpts
+	cmd *cobra.Command
+}
+
+func newIndexCmd(opts *rootOpts) *indexCmd {
+	c := &indexCmd{
+		indexOpts: &indexOpts{buildOpts: &buildOpts{rootOpts: opts, store: newStoreOpts(opts)}},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "index",
+		Short: "maintain the remote index.",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.error("missing <rebuild|verify>")
+			c.example("mrd index <rebuild|verify> [flags...]")
+		},
+	}
+	c.cmd.AddCommand(
+		newIndexRebuildCmd(c.indexOpts).cmd,
+		newIndexVerifyCmd(c.indexOpts).cmd,
+	)
+	return c
+}
+
+type indexRebuildCmd struct {
+	*indexOpts
+	cmd *cobra.Command
+}
+
+func newIndexRebuildCmd(opts *indexOpts) *indexRebuildCmd {
+	c := &indexRebuildCmd{indexOpts: opts}
+	c.cmd = &cobra.Command{
+		Use:   "rebuild",
+		Short: "regenerate index.yaml from the archives in the repository.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.hasErrExit("invalid flags", c.checkDigest())
+			c.store.Load()
+			index := mored.NewIndex()
+			c.do("scanning kits...", func() {
+				index.Kits = c.scan(mored.DefaultKitDist, c.kitChart)
+			})
+			c.do("scanning suites...", func() {
+				index.Suites = c.scan(mored.DefaultSuiteDist, c.suiteChart)
+			})
+			c.do("pushing index...", func() {
+				author := mored.NewAuthor()
+				c.store.replaceIndex(func(remote *mored.Index) {
+					keepStatus(index.Kits, remote.Kits)
+					keepStatus(index.Suites, remote.Suites)
+					remote.Version = index.Version
+					remote.Kits = index.Kits
+					remote.Suites = index.Suites
+					remote.MergeAuthor(author)
+				})
+				c.success("rebuild index success, %d kits and %d suites", len(index.Kits), len(index.Suites))
+			})
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.digest, "digest", "", util.DigestSHA256, "digest algorithm, sha256 or sha512.")
+	return c
+}
+func (c *indexOpts) scan(kind string, normalize func(*mored.Chart) (*mored.Chart, error)) map[string][]*mored.Chart {
+	st := c.store.Storage()
+	objs, err := st.List(kind + "/")
+	c.hasErrExit(fmt.Sprintf("list %s failed", kind), err)
+	tmp, err := os.MkdirTemp("", "mrd-index-*")
+	c.hasErrExit("create temp dir failed", err)
+	defer os.RemoveAll(tmp)
+	charts := make(map[string][]*mored.Chart)
+	for _, obj := range objs {
+		if !strings.HasSuffix(obj.Name, ".tar.gz") {
+			continue
+		}
+		chart, err := c.readArchive(st, obj, filepath.Join(tmp, path.Base(obj.Name)), normalize)
+		if err != nil {
+			c.warn("%s: %s", obj.Name, err.Error())
+			continue
+		}
+		if want := mored.ChartObject(kind, chart); want != obj.Name {
+			c.warn("%s: skipped, %s %s@%s must be stored as %s", obj.Name, kind, chart.Name, chart.Version, want)
+			continue
+		}
+		c.record("indexed", kind, chart)
+		c.info("found %s %s@%s digest:%s", kind, chart.Name, chart.Version, chart.Metadata.Digest)
+		charts[chart.Name] = append(charts[chart.Name], chart)
+	}
+	for _, cts := range charts {
+		mored.SortCharts(cts)
+	}
+	return charts
+}
+
+// keepStatus copies the yanked and deprecated marks of the old index, they are not part of the archives.
+func keepStatus(charts, old map[string][]*mored.Chart) {
+	for name, cts := range charts {
+		for _, ct := range cts {
+			if i := slices.IndexFunc(old[name], func(o *mored.Chart) bool { return o.Version == ct.Version }); i >= 0 {
+				ct.Yanked, ct.Deprecated = old[name][i].Yanked, old[name][i].Deprecated
+			}
+		}
+	}
+}
+func (c *indexOpts) readArchive(st mored.Storage, obj *mored.Object, filename string, normalize func(*mored.Chart) (*mored.Chart, error)) (*mored.Chart, error) {
+	if err := mored.Download(st, obj.Name, filename); err != nil {
+		return nil, err
+	}
+	d, err := util.ReadArchiveFile(filename, mored.DefaultChartFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", mored.DefaultChartFile, err)
+	}
+	chart, err := mored.ParseChart(d)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", mored.DefaultChartFile, err)
+	}
+	if chart, err = normalize(chart); err != nil {
+		return nil, err
+	}
+	if chart.Metadata == nil {
+		chart.Metadata = &mored.Metadata{}
+	}
+	if chart.Metadata.Digest, err = util.FileDigest(filename, c.digest); err != nil {
+		return nil, err
+	}
+	chart.Metadata.Generated = obj.Modified
+	if v := c.trusted(); v != nil {
+		if d, err = os.ReadFile(filename); err != nil {
+			return nil, err
+		}
+		if chart.Metadata.Signer, err = v.verify(st, obj.Name, d); err != nil {
+			c.warn("%s: %s", obj.Name, err.Error())
+			chart.Metadata.Signer = ""
+		}
+	}
+	return chart, nil
+}
+
+type indexVerifyCmd struct {
+	*indexOpts
+	cmd *cobra.Command
+}
+
+func newIndexVerifyCmd(opts *indexOpts) *indexVerifyCmd {
+	c := &indexVerifyCmd{indexOpts: opts}
+	c.cmd = &cobra.Command{
+		Use:   "verify",
+		Short: "check archives, digests and dependencies of every chart in the remote index.",
+		Long: `verify exits with a non-zero status when any chart has problems, example:
+  mrd index verify`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.store.Load()
+			st := c.store.Storage()
+			d, err := mored.ReadObject(st, mored.DefaultIndexFile)
+			c.hasErrExit("failed to load remote index", err)
+			index, err := mored.ParseIndex(d)
+			c.hasErrExit("failed to load remote index", err)
+			tmp, err := os.MkdirTemp("", "mrd-verify-*")
+			c.hasErrExit("create temp dir failed", err)
+			defer os.RemoveAll(tmp)
+
+			r := (&resolveOpts{rootOpts: c.rootOpts, store: c.store}).resolver()
+			r.anyPlatform = true
+			r.indexes[c.store.Remote()] = index
+			var total, failed int
+			if v := c.trusted(); v != nil {
+				if _, err = v.verify(st, mored.DefaultIndexFile, d); err != nil {
+					failed++
+					c.error("%s: %s", mored.DefaultIndexFile, err.Error())
+				}
+			}
+			for _, kind := range []string{mored.DefaultKitDist, mored.DefaultSuiteDist} {
+				charts, normalize := index.Kits, c.kitChart
+				if kind == mored.DefaultSuiteDist {
+					charts, normalize = index.Suites, c.suiteChart
+				}
+				for _, name := range util.SortedKeys(charts) {
+					for _, chart := range charts[name] {
+						total++
+						problems := c.verify(st, r, kind, chart, normalize, filepath.Join(tmp, "chart.tar.gz"))
+						if len(problems) == 0 {
+							c.record("verified", kind, chart)
+							c.success("%s %s@%s", kind, chart.Name, chart.Version)
+							continue
+						}
+						failed++
+						c.record("failed", kind, chart).Problems = problems
+						c.error("%s %s@%s", kind, chart.Name, chart.Version)
+						for _, p := range problems {
+							c.warn("  %s", p)
+						}
+					}
+				}
+			}
+			if failed > 0 {
+				c.fail(validationError("%d of %d entries have problems", failed, total))
+			}
+			c.success("all %d charts verified", total)
+		},
+	}
+	return c
+}
+
+func (c *indexVerifyCmd) verify(st mored.Storage, r *resolver, kind string, chart *mored.Chart, normalize func(*mored.Chart) (*mored.Chart, error), filename string) []string {
+	var problems []string
+	object := mored.ChartObject(kind, chart)
+	if _, err := st.Stat(object); err != nil {
+		return append(problems, fmt.Sprintf("archive %s: %s", object, err.Error()))
+	}
+	if err := mored.Download(st, object, filename); err != nil {
+		return append(problems, err.Error())
+	}
+	defer os.Remove(filename)
+	if err := util.VerifyDigest(filename, mored.ChartDigest(chart)); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if r.verifier != nil {
+		d, err := os.ReadFile(filename)
+		if err != nil {
+			return append(problems, err.Error())
+		}
+		if signer, err := r.verifier.verify(st, object, d); err != nil {
+			problems = append(problems, err.Error())
+		} else if chart.Metadata == nil || signer != chart.Metadata.Signer {
+			problems = append(problems, fmt.Sprintf("signed by %s but index records another signer", signer))
+		}
+	}
+	if d, err := util.ReadArchiveFile(filename, mored.DefaultChartFile); err != nil {
+		problems = append(problems, fmt.Sprintf("read embedded %s failed: %s", mored.DefaultChartFile, err.Error()))
+	} else if embedded, err := mored.ParseChart(d); err != nil {
+		problems = append(problems, fmt.Sprintf("parse embedded %s failed: %s", mored.DefaultChartFile, err.Error()))
+	} else if embedded, err = normalize(embedded); err != nil {
+		problems = append(problems, fmt.Sprintf("embedded %s is invalid: %s", mored.DefaultChartFile, err.Error()))
+	} else {
+		for _, field := range chartDiff(chart, embedded) {
+			problems = append(problems, fmt.Sprintf("embedded %s disagrees on %s", mored.DefaultChartFile, field))
+		}
+	}
+	if chart.Yanked {
+		return problems
+	}
+	req := &requirement{kind: kind, name: chart.Name, remote: c.store.Remote(), constraint: chart.Version}
+	if _, err := r.resolve([]*requirement{req}); err != nil {
+		problems = append(problems, fmt.Sprintf("dependencies: %s", err.Error()))
+	}
+	return problems
+}
+func chartDiff(a, b *mored.Chart) []string {
+	var fields []string
+	check := func(field string, equal bool) {
+		if !equal {
+			fields = append(fields, field)
+		}
+	}
+	check("name", a.Name == b.Name)
+	check("fullName", a.FullName == b.FullName)
+	check("version", a.Version == b.Version)
+	check("command", a.Command == b.Command)
+	check("moredVersion", a.MoredVersion == b.MoredVersion)
+	check("os", slices.Equal(a.Os, b.Os))
+	check("arch", slices.Equal(a.Arch, b.Arch))
+	check("effects", slices.Equal(a.Effects, b.Effects))
+	check("depKits", slices.EqualFunc(a.DepKits, b.DepKits, func(x, y *mored.Dependency) bool { return *x == *y }))
+	check("depSuites", slices.EqualFunc(a.DepSuites, b.DepSuites, func(x, y *mored.Dependency) bool { return *x == *y }))
+	return fields
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"github.com/zohu/reg"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+const (
+	DefaultInstallRoot = ".mored"
+	DefaultConstraint  = ">=0.0.0"
+)
+
+type installOpts struct {
+	*resolveOpts
+	root string
+}
+
+type installCmd struct {
+	*installOpts
+	cmd *cobra.Command
+}
+
+func newInstallCmd(opts *rootOpts) *installCmd {
+	c := &installCmd{
+		installOpts: &installOpts{resolveOpts: newResolveOpts(opts)},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "install [name[@constraint]...]",
+		Short: "install kits or suites and their dependencies from repository.",
+		Long: `install the best matching versions for the current os and arch, example:
+  mrd install hello
+  mrd install hello@^1.2.0 --kind kit
+
+without arguments, install the dependencies of Mored.yaml in the chart directory,
+exactly as recorded in Mored.lock when it exists.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				r, res := c.resolve(args...)
+				c.installAll(r, res.order())
+				return
+			}
+			r, charts := c.locked(c.chart)
+			if charts == nil {
+				var res *resolution
+				r, res = c.lock(c.chart)
+				charts = res.order()
+			}
+			c.installAll(r, charts)
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.root, "root", "r", "", "install root (default is $HOME/.mored)")
+	c.cmd.Flags().StringVarP(&c.chart, "chart", "", ".", "chart directory containing Mored.yaml, used without arguments.")
+	c.cmd.Flags().StringVarP(&c.kind, "kind", "k", "", "kit or suite, required when both have the same name.")
+	c.cmd.Flags().StringVarP(&c.remote, "remote", "", "", "install from http(s):// or file:// repository instead of the configured one.")
+	return c
+}
+
+func (c *installOpts) installRoot() string {
+	if c.root != "" {
+		return c.root
+	}
+	home, err := homedir.Dir()
+	c.hasErrExit("access user dir failed", err)
+	return filepath.Join(home, DefaultInstallRoot)
+}
+
+func supportPlatform(ct *mored.Chart) bool {
+	return (len(ct.Os) == 0 || slices.Contains(ct.Os, runtime.GOOS)) &&
+		(len(ct.Arch) == 0 || slices.Contains(ct.Arch, runtime.GOARCH))
+}
+
+func (c *installOpts) installAll(r *resolver, charts []*resolvedChart) {
+	c.notice(charts)
+	for _, rc := range charts {
+		st, err := r.storage(rc.remote)
+		c.hasErrExit("failed to open remote", storageError(err))
+		c.install(st, r.verifier, rc.kind, rc.chart)
+	}
+}
+func (c *installOpts) install(st mored.Storage, v *verifier, kind string, chart *mored.Chart) {
+	dest, err := c.installPath(kind, chart)
+	c.hasErrExit(fmt.Sprintf("install %s failed", chart.Name), err)
+	if util.IsExisted(dest) {
+		c.record("present", kind, chart).Path = dest
+		c.success("%s %s@%s already installed at %s", kind, chart.Name, chart.Version, dest)
+		return
+	}
+	c.do(fmt.Sprintf("installing %s %s@%s...", kind, chart.Name, chart.Version), func() {
+		c.hasErrExit(fmt.Sprintf("install %s failed", chart.Name), c.extract(st, v, kind, chart, dest))
+		c.record("installed", kind, chart).Path = dest
+		c.success("%s %s@%s installed at %s", kind, chart.Name, chart.Version, dest)
+	})
+}
+
+// installPath returns root/kind/name/version, rejecting charts whose name or version would leave the root.
+func (c *installOpts) installPath(kind string, chart *mored.Chart) (string, error) {
+	if err := mored.VerifyName(chart.Name); err != nil {
+		return "", validationError("%s %q: %w", kind, chart.Name, err)
+	}
+	if reg.Version(chart.Version).IsVersion().NotB() {
+		return "", validationError("%s %s has an invalid version %q", kind, chart.Name, chart.Version)
+	}
+	root, err := filepath.Abs(c.installRoot())
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(root, kind, chart.Name, chart.Version)
+	if rel, err := filepath.Rel(root, dest); err != nil || !filepath.IsLocal(rel) {
+		return "", validationError("%s %s@%s escapes the install root", kind, chart.Name, chart.Version)
+	}
+	return dest, nil
+}
+func (c *installOpts) extract(st mored.Storage, v *verifier, kind string, chart *mored.Chart, dest string) error {
+	base := filepath.Dir(filepath.Dir(dest))
+	if err := os.MkdirAll(base, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(base, ".install-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	gzFile := filepath.Join(tmp, "chart.tar.gz")
+	object := mored.ChartObject(kind, chart)
+	if err = mored.Download(st, object, gzFile); err != nil {
+		return err
+	}
+	if err = util.VerifyDigest(gzFile, mored.ChartDigest(chart)); err != nil {
+		return err
+	}
+	if v != nil {
+		d, err := os.ReadFile(gzFile)
+		if err != nil {
+			return err
+		}
+		if _, err = v.verify(st, object, d); err != nil {
+			return err
+		}
+	}
+	staging := filepath.Join(tmp, "chart")
+	if err = util.UnCompress(gzFile, staging); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(staging, dest)
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	DefaultKeyDir = "keys"
+)
+
+type keyOpts struct {
+	*rootOpts
+	private bool
+}
+
+type keyCmd struct {
+	*keyOpts
+	cmd *cobra.Command
+}
+
+func newKeyCmd(opts *rootOpts) *keyCmd {
+	c := &keyCmd{
+		keyOpts: &keyOpts{rootOpts: opts},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "key",
+		Short: "manage ed25519 keys for signing and verifying charts.",
+		Long: `the signing key signs archives and index.yaml on push,
+public keys in trust.keys are used to verify them on install.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.error("missing <generate|import|export>")
+			c.example("mrd key <generate|import|export> [flags...]")
+		},
+	}
+	generate := &cobra.Command{
+		Use:   "generate",
+		Short: "generate a signing key and trust it.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, priv, err := ed25519.GenerateKey(rand.Reader)
+			c.hasErrExit("generate key failed", err)
+			c.use(priv)
+		},
+	}
+	imports := &cobra.Command{
+		Use:   "import <file>",
+		Short: "import a private key as signing key, or a public key as trusted key.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			d, err := os.ReadFile(args[0])
+			c.hasErrExit("read key failed", err)
+			priv, pub, err := util.DecodeKey(d)
+			c.hasErrExit("parse key failed", err)
+			if priv != nil {
+				c.use(priv)
+				return
+			}
+			c.trust(pub)
+			c.saveConfig()
+			c.success("trusted key %s", util.KeyID(pub))
+		},
+	}
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "print the public key of the signing key.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			priv, err := c.signingKey(viper.GetString("sign.key"))
+			c.hasErrExit("load signing key failed", err)
+			var d []byte
+			if c.private {
+				d, err = util.EncodePrivateKey(priv)
+			} else {
+				d, err = util.EncodePublicKey(priv.Public().(ed25519.PublicKey))
+			}
+			c.hasErrExit("export key failed", err)
+			c.data("key", string(d))
+			if !c.json() {
+				fmt.Print(string(d))
+			}
+		},
+	}
+	export.Flags().BoolVarP(&c.private, "private", "", false, "export the private key instead.")
+	c.cmd.AddCommand(generate, imports, export)
+	return c
+}
+func (c *keyOpts) use(priv ed25519.PrivateKey) {
+	pub := priv.Public().(ed25519.PublicKey)
+	id := util.KeyID(pub)
+	d, err := util.EncodePrivateKey(priv)
+	c.hasErrExit("encode key failed", err)
+	filename := filepath.Join(c.configDir(), DefaultKeyDir, id+".key")
+	c.hasErrExit("create key dir failed", os.MkdirAll(filepath.Dir(filename), 0700))
+	c.hasErrExit("save key failed", os.WriteFile(filename, d, 0600))
+	viper.Set("sign.key", id)
+	c.trust(pub)
+	c.saveConfig()
+	c.success("signing key %s saved at %s", id, filename)
+}
+func (c *keyOpts) trust(pub ed25519.PublicKey) {
+	keys := viper.GetStringSlice("trust.keys")
+	key := base64.StdEncoding.EncodeToString(pub)
+	if !slices.Contains(keys, key) {
+		viper.Set("trust.keys", append(keys, key))
+	}
+}
+
+func (r *rootOpts) signingKey(id string) (ed25519.PrivateKey, error) {
+	if id == "" {
+		return nil, errors.New("no signing key, please use the mrd key generate command")
+	}
+	d, err := os.ReadFile(filepath.Join(r.configDir(), DefaultKeyDir, id+".key"))
+	if err != nil {
+		return nil, err
+	}
+	priv, _, err := util.DecodeKey(d)
+	if err == nil && priv == nil {
+		err = fmt.Errorf("key %s is not a private key", id)
+	}
+	return priv, err
+}
+
+type verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// trusted returns nil when no keys are trusted, signatures are not checked then.
+func (r *rootOpts) trusted() *verifier {
+	keys := viper.GetStringSlice("trust.keys")
+	if len(keys) == 0 {
+		return nil
+	}
+	v := &verifier{keys: make(map[string]ed25519.PublicKey)}
+	for _, key := range keys {
+		pub, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			r.fail(configError("trust.keys contains an invalid key %s", key))
+		}
+		v.keys[util.KeyID(pub)] = pub
+	}
+	return v
+}
+func (v *verifier) verify(st mored.Storage, name string, data []byte) (string, error) {
+	sig, err := mored.ReadObject(st, name+mored.DefaultSignatureExt)
+	if errors.Is(err, mored.ErrObjectNotExist) {
+		return "", fmt.Errorf("%s is not signed", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return util.VerifySignature(v.keys, data, sig)
+}
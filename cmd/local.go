@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"path/filepath"
+)
+
+type localOpts struct {
+	*rootOpts
+	section string
+	domain  string
+	root    string
+	prefix  string
+}
+
+func (s *localOpts) Load() {
+	s.domain = viper.GetString(s.section + ".domain")
+	s.root = viper.GetString(s.section + ".root")
+	s.prefix = viper.GetString(s.section + ".prefix")
+	if s.root == "" || s.prefix == "" {
+		s.fail(configError("local configuration [%s] is incomplete, please use the mrd local or mrd repo add local [flags...] command.", s.section))
+	}
+}
+func (s *localOpts) Remote() string {
+	domain := util.FirstTruthValue(viper.GetString(s.section+".domain"), "file://"+mored.LocalRoot(viper.GetString(s.section+".root")))
+	return fmt.Sprintf("%s/%s", domain, viper.GetString(s.section+".prefix"))
+}
+func (s *localOpts) Storage() (mored.Storage, error) {
+	return mored.NewLocalStorage(filepath.Join(mored.LocalRoot(s.root), s.prefix))
+}
+
+type localCmd struct {
+	*localOpts
+	cmd *cobra.Command
+}
+
+func newLocalCmd(opts *rootOpts, named bool) *localCmd {
+	c := &localCmd{
+		localOpts: &localOpts{rootOpts: opts, section: "local"},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "local",
+		Short: "local directory config for repository.",
+		Long: `publish to a plain directory such as a NFS share, example:
+  mrd local --root file:///srv/mored`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.section = c.configSection("local", args)
+			c.root = mored.LocalRoot(c.root)
+			c.save()
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.domain, "domain", "d", "", "domain the directory is served from, default file://<root>.")
+	c.cmd.Flags().StringVarP(&c.root, "root", "r", "", "repository directory or file:// url.")
+	c.cmd.Flags().StringVarP(&c.prefix, "prefix", "", "repo", "local prefix")
+
+	_ = c.cmd.MarkFlagRequired("root")
+
+	if named {
+		c.named(c.cmd)
+		return c
+	}
+	_ = viper.BindPFlag("local.domain", c.cmd.Flags().Lookup("domain"))
+	_ = viper.BindPFlag("local.root", c.cmd.Flags().Lookup("root"))
+	_ = viper.BindPFlag("local.prefix", c.cmd.Flags().Lookup("prefix"))
+	return c
+}
+
+func (c *localCmd) save() {
+	viper.Set(c.section+".domain", c.domain)
+	viper.Set(c.section+".root", c.root)
+	viper.Set(c.section+".prefix", c.prefix)
+	c.setStorage(c.section, "local")
+	c.saveConfig()
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	DefaultLockFile    = "Mored.lock"
+	DefaultLockVersion = "v1"
+)
+
+type LockedChart struct {
+	Kind    string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Remote  string `json:"remote,omitempty" yaml:"remote,omitempty"`
+	Digest  string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+type Lock struct {
+	Version   string         `json:"version,omitempty" yaml:"version,omitempty"`
+	Requires  []*LockedChart `json:"requires,omitempty" yaml:"requires,omitempty"`
+	Charts    []*LockedChart `json:"charts,omitempty" yaml:"charts,omitempty"`
+	Generated time.Time      `json:"generated,omitempty" yaml:"generated,omitempty"`
+}
+
+func readLock(filename string) (*Lock, error) {
+	d, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err = yaml.Unmarshal(d, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+func writeLock(filename string, lock *Lock) error {
+	d, err := yaml.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(filename, d)
+}
+
+// requires lists the direct dependencies declared in Mored.yaml, a lockfile is stale when they change.
+func (c *resolveOpts) requires(reqs []*requirement) []*LockedChart {
+	var out []*LockedChart
+	for _, req := range reqs {
+		out = append(out, &LockedChart{Kind: req.kind, Name: req.name, Version: req.constraint, Remote: req.remote})
+	}
+	return out
+}
+func (c *resolveOpts) chartRequirements(dir string) (*resolver, []*requirement) {
+	chart, err := mored.ReadChart(filepath.Join(dir, mored.DefaultChartFile))
+	c.hasErrExit("load Mored.yaml failed", err)
+	r := c.resolver()
+	remote := c.defaultRemote()
+	from := fmt.Sprintf("%s %s", chart.Name, mored.DefaultChartFile)
+	var reqs []*requirement
+	for _, dep := range chart.DepKits {
+		reqs = append(reqs, r.dependency(mored.DefaultKitDist, dep, remote, from))
+	}
+	for _, dep := range chart.DepSuites {
+		reqs = append(reqs, r.dependency(mored.DefaultSuiteDist, dep, remote, from))
+	}
+	return r, reqs
+}
+func (c *resolveOpts) lock(dir string) (*resolver, *resolution) {
+	r, reqs := c.chartRequirements(dir)
+	res, err := r.resolve(reqs)
+	c.hasErrExit("resolve failed", err)
+	lock := &Lock{Version: DefaultLockVersion, Requires: c.requires(reqs), Generated: time.Now()}
+	for _, rc := range res.order() {
+		lock.Charts = append(lock.Charts, &LockedChart{
+			Kind:    rc.kind,
+			Name:    rc.chart.Name,
+			Version: rc.chart.Version,
+			Remote:  rc.remote,
+			Digest:  mored.ChartDigest(rc.chart),
+		})
+	}
+	filename := filepath.Join(dir, DefaultLockFile)
+	c.do(fmt.Sprintf("writing %s...", filename), func() {
+		c.hasErrExit("write lock failed", writeLock(filename, lock))
+	})
+	return r, res
+}
+func (c *resolveOpts) locked(dir string) (*resolver, []*resolvedChart) {
+	filename := filepath.Join(dir, DefaultLockFile)
+	if !util.IsExisted(filename) {
+		return nil, nil
+	}
+	lock, err := readLock(filename)
+	c.hasErrExit("load Mored.lock failed", err)
+	r, reqs := c.chartRequirements(dir)
+	if !slices.EqualFunc(lock.Requires, c.requires(reqs), func(a, b *LockedChart) bool { return *a == *b }) {
+		c.warn("%s is out of date with %s, resolving again", DefaultLockFile, mored.DefaultChartFile)
+		return nil, nil
+	}
+	var out []*resolvedChart
+	for _, lc := range lock.Charts {
+		charts, err := r.charts(lc.Kind, lc.Name, lc.Remote)
+		c.hasErrExit("load locked chart failed", err)
+		i := slices.IndexFunc(charts, func(ct *mored.Chart) bool { return ct.Version == lc.Version })
+		if i < 0 {
+			c.exit("locked %s %s@%s no longer exists in %s", lc.Kind, lc.Name, lc.Version, lc.Remote)
+		}
+		if mored.ChartDigest(charts[i]) != lc.Digest {
+			c.exit("locked %s %s@%s digest changed in %s, expected %s", lc.Kind, lc.Name, lc.Version, lc.Remote, lc.Digest)
+		}
+		out = append(out, &resolvedChart{kind: lc.Kind, remote: lc.Remote, chart: charts[i]})
+	}
+	return r, out
+}
@@ -2,15 +2,15 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/pkg/mored"
 	"github.com/zohu/reg"
-	"path"
 )
 
 type ossOpts struct {
 	*rootOpts
+	section  string
 	domain   string
 	endpoint string
 	key      string
@@ -20,36 +20,29 @@ type ossOpts struct {
 }
 
 func (s *ossOpts) Load() {
-	s.domain = viper.GetString("oss.domain")
-	s.endpoint = viper.GetString("oss.endpoint")
-	s.key = viper.GetString("oss.key")
-	s.secret = viper.GetString("oss.secret")
-	s.bucket = viper.GetString("oss.bucket")
-	s.prefix = viper.GetString("oss.prefix")
-	if s.endpoint == "" || s.key == "" || s.secret == "" || s.bucket == "" || s.prefix == "" {
-		s.exit("OSS configuration is incomplete, please use the mrd oss [flags...] command. command.")
+	s.domain = viper.GetString(s.section + ".domain")
+	s.endpoint = viper.GetString(s.section + ".endpoint")
+	s.key, s.secret = s.credentials(s.section, s.endpoint)
+	s.bucket = viper.GetString(s.section + ".bucket")
+	s.prefix = viper.GetString(s.section + ".prefix")
+	if s.endpoint == "" || s.bucket == "" || s.prefix == "" {
+		s.fail(configError("OSS configuration [%s] is incomplete, please use the mrd oss or mrd repo add oss [flags...] command.", s.section))
+	}
+	if s.key == "" || s.secret == "" {
+		s.fail(configError("no credentials for [%s], set %s and %s, a credential helper or the credentials file", s.section, credentialEnv(s.section, "key"), credentialEnv(s.section, "secret")))
 	}
 }
 func (s *ossOpts) Remote() string {
-	return fmt.Sprintf("%s/%s", s.domain, s.prefix)
+	return fmt.Sprintf("%s/%s", viper.GetString(s.section+".domain"), viper.GetString(s.section+".prefix"))
 }
-func (s *ossOpts) Bucket() *oss.Bucket {
-	clt, err := oss.New(s.endpoint, s.key, s.secret)
-	s.hasErrExit("failed to initialize OSS", err)
-	bkt, err := clt.Bucket(s.bucket)
-	s.hasErrExit("failed to initialize OSS bucket", err)
-	return bkt
-}
-func (s *ossOpts) Upload(dir string, files ...string) {
-	bkt := s.Bucket()
-	ossName := s.prefix
-	if dir != "" {
-		ossName = fmt.Sprintf("%s/%s", ossName, dir)
-	}
-	for _, f := range files {
-		ossName = fmt.Sprintf("%s/%s", ossName, path.Base(f))
-		s.hasErrExit("push to remote failed", bkt.PutObjectFromFile(ossName, f))
-	}
+func (s *ossOpts) Storage() (mored.Storage, error) {
+	return mored.NewOSSStorage(mored.OSSConfig{
+		Endpoint: s.endpoint,
+		Key:      s.key,
+		Secret:   s.secret,
+		Bucket:   s.bucket,
+		Prefix:   s.prefix,
+	})
 }
 
 type ossCmd struct {
@@ -57,15 +50,18 @@ type ossCmd struct {
 	cmd *cobra.Command
 }
 
-func newOssCmd(opts *rootOpts) *ossCmd {
+func newOssCmd(opts *rootOpts, named bool) *ossCmd {
 	c := &ossCmd{
-		ossOpts: &ossOpts{rootOpts: opts},
+		ossOpts: &ossOpts{rootOpts: opts, section: "oss"},
 	}
 	c.cmd = &cobra.Command{
 		Use:   "oss",
 		Short: "oss config for repository.",
-		Args:  cobra.NoArgs,
+		Long: `the key and secret may be omitted when they come from the environment or a credential helper, example:
+  mrd oss --endpoint oss-cn-hangzhou.aliyuncs.com --bucket mored --key ... --secret ...` + credentialsHelp,
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			c.section = c.configSection("oss", args)
 			if reg.String(c.domain).IsUrl().NotB() {
 				c.domain = fmt.Sprintf("https://%s.%s", c.bucket, c.endpoint)
 			}
@@ -74,16 +70,18 @@ func newOssCmd(opts *rootOpts) *ossCmd {
 	}
 	c.cmd.Flags().StringVarP(&c.domain, "domain", "d", "", "oss domain.")
 	c.cmd.Flags().StringVarP(&c.endpoint, "endpoint", "p", "", "oss endpoint.")
-	c.cmd.Flags().StringVarP(&c.key, "key", "k", "", "oss key.")
-	c.cmd.Flags().StringVarP(&c.secret, "secret", "s", "", "oss secret.")
+	c.cmd.Flags().StringVarP(&c.key, "key", "k", "", "oss key, saved to the credentials file.")
+	c.cmd.Flags().StringVarP(&c.secret, "secret", "s", "", "oss secret, saved to the credentials file.")
 	c.cmd.Flags().StringVarP(&c.bucket, "bucket", "b", "", "oss bucket.")
 	c.cmd.Flags().StringVarP(&c.prefix, "prefix", "", "repo", "oss prefix")
 
 	_ = c.cmd.MarkFlagRequired("endpoint")
-	_ = c.cmd.MarkFlagRequired("key")
-	_ = c.cmd.MarkFlagRequired("secret")
 	_ = c.cmd.MarkFlagRequired("bucket")
 
+	if named {
+		c.named(c.cmd)
+		return c
+	}
 	_ = viper.BindPFlag("oss.domain", c.cmd.Flags().Lookup("domain"))
 	_ = viper.BindPFlag("oss.endpoint", c.cmd.Flags().Lookup("endpoint"))
 	_ = viper.BindPFlag("oss.key", c.cmd.Flags().Lookup("key"))
@@ -94,11 +92,12 @@ func newOssCmd(opts *rootOpts) *ossCmd {
 }
 
 func (c *ossCmd) save() {
-	viper.Set("oss.domain", c.domain)
-	viper.Set("oss.endpoint", c.endpoint)
-	viper.Set("oss.key", c.key)
-	viper.Set("oss.secret", c.secret)
-	viper.Set("oss.bucket", c.bucket)
-	viper.Set("oss.prefix", c.prefix)
+	viper.Set(c.section+".domain", c.domain)
+	viper.Set(c.section+".endpoint", c.endpoint)
+	viper.Set(c.section+".key", c.key)
+	viper.Set(c.section+".secret", c.secret)
+	viper.Set(c.section+".bucket", c.bucket)
+	viper.Set(c.section+".prefix", c.prefix)
+	c.setStorage(c.section, "oss")
 	c.saveConfig()
 }
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// event is a single line of --output json, the last line is the result.
+type event struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type resultChart struct {
+	Kind     string   `json:"kind,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Remote   string   `json:"remote,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Digest   string   `json:"digest,omitempty"`
+	Deps     []string `json:"deps,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+type result struct {
+	mu       sync.Mutex
+	Event    string         `json:"event"`
+	Command  string         `json:"command,omitempty"`
+	Ok       bool           `json:"ok"`
+	Code     int            `json:"code"`
+	DryRun   bool           `json:"dryRun,omitempty"`
+	Charts   []*resultChart `json:"charts,omitempty"`
+	Uploaded []string       `json:"uploaded,omitempty"`
+	Deleted  []string       `json:"deleted,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+	Errors   []string       `json:"errors,omitempty"`
+}
+
+func newResult() *result {
+	return &result{Event: "result", Data: make(map[string]any)}
+}
+
+func (r *rootOpts) json() bool {
+	return r.output == OutputJSON
+}
+
+// emit writes one json line, lines of concurrent builds are never interleaved.
+func (r *rootOpts) emit(v any) {
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	_ = json.NewEncoder(os.Stdout).Encode(v)
+}
+func (r *rootOpts) event(name, message string) {
+	if r.json() {
+		r.emit(&event{Event: name, Message: message, Time: time.Now()})
+	}
+}
+func (r *rootOpts) record(status, kind string, chart *mored.Chart) *resultChart {
+	rc := &resultChart{Kind: kind, Name: chart.Name, Version: chart.Version, Status: status, Digest: mored.ChartDigest(chart)}
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	r.result.Charts = append(r.result.Charts, rc)
+	return rc
+}
+func (r *rootOpts) uploaded(names ...string) {
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	r.result.Uploaded = append(r.result.Uploaded, names...)
+}
+func (r *rootOpts) deleted(names ...string) {
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	r.result.Deleted = append(r.result.Deleted, names...)
+}
+func (r *rootOpts) data(key string, v any) {
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	r.result.Data[key] = v
+}
+func (r *rootOpts) collect(warning, err string) {
+	r.result.mu.Lock()
+	defer r.result.mu.Unlock()
+	if warning != "" {
+		r.result.Warnings = append(r.result.Warnings, warning)
+	}
+	if err != "" {
+		r.result.Errors = append(r.result.Errors, err)
+	}
+}
+func (r *rootOpts) finish() {
+	if !r.json() {
+		return
+	}
+	r.result.Ok = len(r.result.Errors) == 0
+	r.result.DryRun = r.dry
+	r.emit(r.result)
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/util"
+	"github.com/zohu/reg"
+	"strings"
+)
+
+const (
+	DefaultRepoSection = "repos"
+	DefaultRepoKey     = "repo"
+	DefaultRepoPattern = `^[a-z][a-z0-9_-]{0,63}$`
+)
+
+type repoInfo struct {
+	Name    string `json:"name"`
+	Storage string `json:"storage"`
+	Remote  string `json:"remote"`
+	Default bool   `json:"default,omitempty"`
+}
+
+type repoCmd struct {
+	*rootOpts
+	cmd *cobra.Command
+}
+
+func newRepoCmd(opts *rootOpts) *repoCmd {
+	c := &repoCmd{rootOpts: opts}
+	c.cmd = &cobra.Command{
+		Use:   "repo",
+		Short: "manage named repositories.",
+		Long: `named repositories have their own storage and credentials, select one with --repo, example:
+  mrd repo add oss prod --endpoint oss-cn-hangzhou.aliyuncs.com --key ... --secret ... --bucket mored
+  mrd repo default prod
+  mrd build kit --push --repo dev
+
+dependencies may use the name of a repository as remote.` + credentialsHelp,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.error("missing <add|list|remove|default>")
+			c.example("mrd repo <add|list|remove|default> [flags...]")
+		},
+	}
+	add := &cobra.Command{
+		Use:   "add",
+		Short: "register a named repository.",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.error("missing <oss|s3|local>")
+			c.example("mrd repo add <oss|s3|local> <name> [flags...]")
+		},
+	}
+	add.AddCommand(
+		newOssCmd(opts, true).cmd,
+		newS3Cmd(opts, true).cmd,
+		newLocalCmd(opts, true).cmd,
+	)
+	c.cmd.AddCommand(
+		add,
+		&cobra.Command{
+			Use:   "list",
+			Short: "list the named repositories.",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				c.list()
+			},
+		},
+		&cobra.Command{
+			Use:   "remove <name>",
+			Short: "remove a named repository.",
+			Args:  cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				c.remove(args[0])
+			},
+		},
+		&cobra.Command{
+			Use:   "default [name]",
+			Short: "print or set the repository used without --repo.",
+			Args:  cobra.MaximumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				if len(args) == 0 {
+					c.data("default", viper.GetString(DefaultRepoKey))
+					c.info("default repository: %s", util.FirstTruthValue(viper.GetString(DefaultRepoKey), "none"))
+					return
+				}
+				if !viper.IsSet(repoSection(args[0])) {
+					c.fail(configError("repository %s is not registered", args[0]))
+				}
+				viper.Set(DefaultRepoKey, args[0])
+				c.saveConfig()
+				c.success("default repository is %s", args[0])
+			},
+		},
+	)
+	return c
+}
+
+func (c *repoCmd) list() {
+	var repos []*repoInfo
+	for _, name := range registeredRepos() {
+		section := repoSection(name)
+		info := &repoInfo{Name: name, Storage: viper.GetString(section + ".storage"), Default: name == viper.GetString(DefaultRepoKey)}
+		if d, ok := newDriver(c.rootOpts, info.Storage, section); ok {
+			info.Remote = d.Remote()
+		}
+		repos = append(repos, info)
+	}
+	c.data("repos", repos)
+	if len(repos) == 0 {
+		c.info("no named repositories, the %s config is used", util.FirstTruthValue(viper.GetString("storage"), DefaultStorageDriver))
+		return
+	}
+	for _, r := range repos {
+		mark := " "
+		if r.Default {
+			mark = "*"
+		}
+		c.info("%s %s (%s) %s", mark, r.Name, r.Storage, r.Remote)
+	}
+}
+
+// remove rewrites the config without the repository, viper cannot unset keys.
+func (c *repoCmd) remove(name string) {
+	if !viper.IsSet(repoSection(name)) {
+		c.fail(configError("repository %s is not registered", name))
+	}
+	settings := viper.AllSettings()
+	if repos, ok := settings[DefaultRepoSection].(map[string]any); ok {
+		delete(repos, name)
+	}
+	if viper.GetString(DefaultRepoKey) == name {
+		delete(settings, DefaultRepoKey)
+		c.warn("%s was the default repository, the %s config is used now", name, util.FirstTruthValue(viper.GetString("storage"), DefaultStorageDriver))
+	}
+	c.writeConfig(settings)
+	c.removeCredentials(repoSection(name))
+	c.success("repository %s removed", name)
+}
+
+// named turns the config command of a storage into `mrd repo add <storage> <name>`.
+func (r *rootOpts) named(cmd *cobra.Command) {
+	cmd.Short = fmt.Sprintf("register a named %s repository.", cmd.Name())
+	cmd.Use = cmd.Name() + " <name>"
+	cmd.Args = cobra.ExactArgs(1)
+	run := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		run(cmd, args)
+		r.success("repository %s added", args[0])
+	}
+}
+
+// configSection is the config section a storage command writes, the single repository of older
+// configs is stored under the name of its storage.
+func (r *rootOpts) configSection(storage string, args []string) string {
+	if len(args) == 0 {
+		return storage
+	}
+	if reg.String(args[0]).Match(DefaultRepoPattern).NotB() {
+		r.fail(configError("repository name must match %s", DefaultRepoPattern))
+	}
+	return repoSection(args[0])
+}
+func (r *rootOpts) setStorage(section, storage string) {
+	if section == storage {
+		viper.Set("storage", storage)
+		return
+	}
+	viper.Set(section+".storage", storage)
+}
+func repoSection(name string) string {
+	return fmt.Sprintf("%s.%s", DefaultRepoSection, strings.ToLower(name))
+}
+func registeredRepos() []string {
+	return util.SortedKeys(viper.GetStringMap(DefaultRepoSection))
+}
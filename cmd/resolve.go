@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+	"github.com/zohu/reg"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+type resolveOpts struct {
+	*rootOpts
+	store  *storeOpts
+	kind   string
+	remote string
+	chart  string
+}
+
+func newResolveOpts(opts *rootOpts) *resolveOpts {
+	return &resolveOpts{rootOpts: opts, store: newStoreOpts(opts)}
+}
+
+func (c *resolveOpts) target(arg string) (string, string) {
+	name, constraint, _ := strings.Cut(arg, "@")
+	constraint = util.FirstTruthValue(strings.TrimSpace(constraint), DefaultConstraint)
+	if reg.Version(constraint).IsVersionSupport().NotB() {
+		c.fail(validationError("version constraint %s supports prefixes: (~) patch, (^) minor, (>=) greater than or equal to, (<=) less than or equal to", constraint))
+	}
+	return strings.TrimSpace(name), constraint
+}
+func (c *resolveOpts) defaultRemote() string {
+	if c.remote != "" {
+		return strings.TrimSuffix(c.remote, "/")
+	}
+	c.store.Load()
+	return c.store.Remote()
+}
+
+// open uses the credentials of the configured or a registered repository, and anonymous access otherwise.
+func (c *resolveOpts) open(remote string) (mored.Storage, error) {
+	if c.remote == "" && remote == c.store.Remote() {
+		c.store.Load()
+		return c.store.Storage(), nil
+	}
+	if st := c.store.registered(remote); st != nil {
+		return st.Storage(), nil
+	}
+	return mored.OpenRemote(remote)
+}
+func (c *resolveOpts) resolver() *resolver {
+	return &resolver{
+		open:     c.open,
+		indexes:  make(map[string]*mored.Index),
+		storages: make(map[string]mored.Storage),
+		remotes:  c.store.remotes(),
+		verifier: c.trusted(),
+	}
+}
+func (c *resolveOpts) resolve(args ...string) (*resolver, *resolution) {
+	r := c.resolver()
+	remote := c.defaultRemote()
+	var reqs []*requirement
+	for _, arg := range args {
+		name, constraint := c.target(arg)
+		kind, err := r.kindOf(remote, name, c.kind)
+		c.hasErrExit("resolve failed", err)
+		reqs = append(reqs, &requirement{kind: kind, name: name, remote: remote, constraint: constraint})
+	}
+	res, err := r.resolve(reqs)
+	c.hasErrExit("resolve failed", err)
+	return r, res
+}
+
+// notice warns about deprecated charts, and yanked ones which are only selected when locked.
+func (c *resolveOpts) notice(charts []*resolvedChart) {
+	for _, rc := range charts {
+		if rc.chart.Yanked {
+			c.warn("%s is yanked, kept because it is locked in %s", rc, DefaultLockFile)
+		}
+		if rc.chart.Deprecated != "" {
+			c.warn("%s is deprecated: %s", rc, rc.chart.Deprecated)
+		}
+	}
+}
+
+type requirement struct {
+	kind       string
+	name       string
+	remote     string
+	constraint string
+	from       string
+}
+
+func (r *requirement) key() string {
+	return fmt.Sprintf("%s/%s@%s", r.kind, r.name, r.remote)
+}
+func (r *requirement) String() string {
+	return fmt.Sprintf("%s required by %s", r.constraint, util.FirstTruthValue(r.from, "command line"))
+}
+
+type resolvedChart struct {
+	kind   string
+	remote string
+	chart  *mored.Chart
+	deps   []string
+}
+
+func (r *resolvedChart) String() string {
+	return fmt.Sprintf("%s %s@%s", r.kind, r.chart.Name, r.chart.Version)
+}
+
+type resolution struct {
+	roots  []string
+	charts map[string]*resolvedChart
+}
+
+func (r *resolution) order() []*resolvedChart {
+	var out []*resolvedChart
+	seen := make(map[string]bool)
+	var visit func(key string)
+	visit = func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		for _, dep := range r.charts[key].deps {
+			visit(dep)
+		}
+		out = append(out, r.charts[key])
+	}
+	for _, key := range r.roots {
+		visit(key)
+	}
+	return out
+}
+
+type resolver struct {
+	open        func(remote string) (mored.Storage, error)
+	indexes     map[string]*mored.Index
+	storages    map[string]mored.Storage
+	remotes     map[string]string
+	verifier    *verifier
+	anyPlatform bool
+}
+
+func (r *resolver) storage(remote string) (mored.Storage, error) {
+	if st, ok := r.storages[remote]; ok {
+		return st, nil
+	}
+	st, err := r.open(remote)
+	if err != nil {
+		return nil, err
+	}
+	r.storages[remote] = st
+	return st, nil
+}
+func (r *resolver) index(remote string) (*mored.Index, error) {
+	if index, ok := r.indexes[remote]; ok {
+		return index, nil
+	}
+	st, err := r.storage(remote)
+	if err != nil {
+		return nil, fmt.Errorf("open %s failed: %w", remote, err)
+	}
+	d, err := mored.ReadObject(st, mored.DefaultIndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("load index of %s failed: %w", remote, err)
+	}
+	if r.verifier != nil {
+		if _, err = r.verifier.verify(st, mored.DefaultIndexFile, d); err != nil {
+			return nil, fmt.Errorf("verify index of %s failed: %w", remote, err)
+		}
+	}
+	index, err := mored.ParseIndex(d)
+	if err != nil {
+		return nil, fmt.Errorf("load index of %s failed: %w", remote, err)
+	}
+	r.indexes[remote] = index
+	return index, nil
+}
+func (r *resolver) charts(kind, name, remote string) ([]*mored.Chart, error) {
+	index, err := r.index(remote)
+	if err != nil {
+		return nil, err
+	}
+	charts := index.Kits[name]
+	if kind == mored.DefaultSuiteDist {
+		charts = index.Suites[name]
+	}
+	// names and versions of a remote index end up in install paths
+	if err = mored.VerifyName(name); err != nil {
+		return nil, fmt.Errorf("%s %q: %w", kind, name, err)
+	}
+	for _, ct := range charts {
+		if ct.Name != name || reg.Version(ct.Version).IsVersion().NotB() {
+			return nil, fmt.Errorf("index of %s has an invalid %s entry %s@%s", remote, kind, ct.Name, ct.Version)
+		}
+	}
+	return charts, nil
+}
+func (r *resolver) kindOf(remote, name, kind string) (string, error) {
+	index, err := r.index(remote)
+	if err != nil {
+		return "", err
+	}
+	var kinds []string
+	if len(index.Kits[name]) > 0 && (kind == "" || kind == mored.DefaultKitDist) {
+		kinds = append(kinds, mored.DefaultKitDist)
+	}
+	if len(index.Suites[name]) > 0 && (kind == "" || kind == mored.DefaultSuiteDist) {
+		kinds = append(kinds, mored.DefaultSuiteDist)
+	}
+	switch len(kinds) {
+	case 0:
+		return "", fmt.Errorf("%s not found in %s", name, remote)
+	case 2:
+		return "", fmt.Errorf("both kit and suite named %s exist, please use --kind", name)
+	}
+	return kinds[0], nil
+}
+
+func (r *resolver) resolve(roots []*requirement) (*resolution, error) {
+	res := &resolution{charts: make(map[string]*resolvedChart)}
+	for _, req := range roots {
+		res.roots = append(res.roots, req.key())
+	}
+	charts, err := r.solve(roots, make(map[string]*resolvedChart), make(map[string][]*requirement))
+	if err != nil {
+		return nil, err
+	}
+	res.charts = charts
+	if cycle := res.cycle(); len(cycle) > 0 {
+		return nil, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return res, nil
+}
+
+// solve picks the highest version of each requirement and backtracks when a later requirement conflicts.
+func (r *resolver) solve(queue []*requirement, selected map[string]*resolvedChart, reqs map[string][]*requirement) (map[string]*resolvedChart, error) {
+	if len(queue) == 0 {
+		return selected, nil
+	}
+	req, queue := queue[0], queue[1:]
+	key := req.key()
+	reqs = maps.Clone(reqs)
+	reqs[key] = append(slices.Clone(reqs[key]), req)
+	if sel, ok := selected[key]; ok {
+		if reg.Version(sel.chart.Version).Support(req.constraint).NotB() {
+			return nil, r.conflict(req, reqs[key], sel.chart.Version)
+		}
+		return r.solve(queue, selected, reqs)
+	}
+	all, err := r.charts(req.kind, req.name, req.remote)
+	if err != nil {
+		return nil, err
+	}
+	candidates := r.candidates(all, reqs[key])
+	if len(candidates) == 0 {
+		return nil, r.unsatisfiable(req, reqs[key], all)
+	}
+	var last error
+	for _, ct := range candidates {
+		node := &resolvedChart{kind: req.kind, remote: req.remote, chart: ct}
+		next := slices.Clone(queue)
+		for _, dep := range r.dependencies(node) {
+			node.deps = append(node.deps, dep.key())
+			next = append(next, dep)
+		}
+		sel := maps.Clone(selected)
+		sel[key] = node
+		out, err := r.solve(next, sel, reqs)
+		if err == nil {
+			return out, nil
+		}
+		last = err
+	}
+	return nil, last
+}
+func (r *resolver) candidates(charts []*mored.Chart, reqs []*requirement) []*mored.Chart {
+	var out []*mored.Chart
+	for _, ct := range charts {
+		if ct.Yanked || (!r.anyPlatform && !supportPlatform(ct)) {
+			continue
+		}
+		ok := true
+		for _, req := range reqs {
+			if reg.Version(ct.Version).Support(req.constraint).NotB() {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, ct)
+		}
+	}
+	slices.SortFunc(out, func(a, b *mored.Chart) int {
+		if reg.Version(a.Version).HighThan(b.Version).B() {
+			return -1
+		}
+		if reg.Version(a.Version).LowThan(b.Version).B() {
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+func (r *resolver) dependencies(node *resolvedChart) []*requirement {
+	var deps []*requirement
+	from := node.String()
+	for _, dep := range node.chart.DepKits {
+		deps = append(deps, r.dependency(mored.DefaultKitDist, dep, node.remote, from))
+	}
+	for _, dep := range node.chart.DepSuites {
+		deps = append(deps, r.dependency(mored.DefaultSuiteDist, dep, node.remote, from))
+	}
+	return deps
+}
+func (r *resolver) dependency(kind string, dep *mored.Dependency, remote, from string) *requirement {
+	return &requirement{
+		kind:       kind,
+		name:       dep.Name,
+		remote:     strings.TrimSuffix(util.FirstTruthValue(r.remotes[dep.Remote], dep.Remote, remote), "/"),
+		constraint: util.FirstTruthValue(dep.Version, DefaultConstraint),
+		from:       from,
+	}
+}
+
+func (r *resolver) conflict(req *requirement, reqs []*requirement, version string) error {
+	return fmt.Errorf("conflict on %s %s, %s was selected but:\n%s", req.kind, req.name, version, r.explain(reqs))
+}
+func (r *resolver) unsatisfiable(req *requirement, reqs []*requirement, all []*mored.Chart) error {
+	if len(all) == 0 {
+		return fmt.Errorf("%s %s not found in %s (%s)", req.kind, req.name, req.remote, req)
+	}
+	var versions, yanked []string
+	for _, ct := range all {
+		if ct.Yanked {
+			yanked = append(yanked, ct.Version)
+		} else if r.anyPlatform || supportPlatform(ct) {
+			versions = append(versions, ct.Version)
+		}
+	}
+	if len(versions) == 0 && len(yanked) == len(all) {
+		return fmt.Errorf("%s %s has only yanked versions (%s)", req.kind, req.name, req)
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("%s %s has no version for %s/%s (%s)", req.kind, req.name, runtime.GOOS, runtime.GOARCH, req)
+	}
+	err := fmt.Errorf("no version of %s %s satisfies all of:\n%s\n  available: %s", req.kind, req.name, r.explain(reqs), strings.Join(versions, ", "))
+	if len(yanked) > 0 {
+		err = fmt.Errorf("%w\n  yanked: %s", err, strings.Join(yanked, ", "))
+	}
+	return err
+}
+func (r *resolver) explain(reqs []*requirement) string {
+	var lines []string
+	for _, req := range reqs {
+		lines = append(lines, "  - "+req.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *resolution) cycle() []string {
+	state := make(map[string]int)
+	var path []string
+	var visit func(key string) []string
+	visit = func(key string) []string {
+		switch state[key] {
+		case 1:
+			i := slices.Index(path, key)
+			var cycle []string
+			for _, k := range append(path[i:], key) {
+				cycle = append(cycle, r.charts[k].String())
+			}
+			return cycle
+		case 2:
+			return nil
+		}
+		state[key] = 1
+		path = append(path, key)
+		for _, dep := range r.charts[key].deps {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = 2
+		return nil
+	}
+	for _, key := range r.roots {
+		if cycle := visit(key); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
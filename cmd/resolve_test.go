@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"strings"
+	"testing"
+)
+
+const (
+	testRemote  = "file:///repo"
+	otherRemote = "file:///other"
+)
+
+func kit(name, version string, deps ...*mored.Dependency) *mored.Chart {
+	return &mored.Chart{Name: name, Version: version, DepKits: deps}
+}
+func dep(name, version string) *mored.Dependency {
+	return &mored.Dependency{Name: name, Version: version}
+}
+func yanked(ct *mored.Chart) *mored.Chart {
+	ct.Yanked = true
+	return ct
+}
+func kits(charts ...*mored.Chart) *mored.Index {
+	index := mored.NewIndex()
+	for _, ct := range charts {
+		index.Kits[ct.Name] = append(index.Kits[ct.Name], ct)
+	}
+	return index
+}
+
+// testResolver resolves against in-memory indexes, opening any other remote fails.
+func testResolver(indexes map[string]*mored.Index) *resolver {
+	return &resolver{
+		open: func(remote string) (mored.Storage, error) {
+			return nil, errors.New("unexpected open of " + remote)
+		},
+		indexes:  indexes,
+		storages: make(map[string]mored.Storage),
+		remotes:  map[string]string{"other": otherRemote},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	crossRemote := kit("app", "1.0.0", &mored.Dependency{Name: "lib", Version: "^1.0.0", Remote: "other"})
+	cases := []struct {
+		name    string
+		indexes map[string]*mored.Index
+		roots   []string
+		want    map[string]string
+		err     string
+	}{
+		{
+			name:    "highest version",
+			indexes: map[string]*mored.Index{testRemote: kits(kit("alpha", "1.0.0"), kit("alpha", "1.2.0"), kit("alpha", "1.1.0"))},
+			roots:   []string{"alpha"},
+			want:    map[string]string{"alpha": "1.2.0"},
+		},
+		{
+			name: "conflict backtracking",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "2.0.0", dep("beta", ">=2.0.0")),
+				kit("alpha", "1.0.0", dep("beta", "^1.0.0")),
+				kit("gamma", "1.0.0", dep("beta", "^1.0.0")),
+				kit("beta", "1.0.0"),
+				kit("beta", "2.0.0"),
+			)},
+			roots: []string{"alpha", "gamma"},
+			want:  map[string]string{"alpha": "1.0.0", "beta": "1.0.0", "gamma": "1.0.0"},
+		},
+		{
+			name: "unsatisfiable dependency backtracking",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "2.0.0", dep("beta", "^2.0.0")),
+				kit("alpha", "1.0.0", dep("beta", "^1.0.0")),
+				kit("beta", "1.0.0"),
+			)},
+			roots: []string{"alpha"},
+			want:  map[string]string{"alpha": "1.0.0", "beta": "1.0.0"},
+		},
+		{
+			name: "conflict",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "1.0.0"),
+				kit("alpha", "2.0.0"),
+				kit("beta", "1.0.0", dep("alpha", "^2.0.0")),
+			)},
+			roots: []string{"alpha@^1.0.0", "beta"},
+			err:   "conflict on kit alpha, 1.0.0 was selected but:\n  - ^1.0.0 required by command line\n  - ^2.0.0 required by kit beta@1.0.0",
+		},
+		{
+			name: "no version satisfies",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "1.0.0"),
+				kit("alpha", "1.1.0"),
+			)},
+			roots: []string{"alpha@^2.0.0"},
+			err:   "no version of kit alpha satisfies all of:\n  - ^2.0.0 required by command line\n  available: 1.0.0, 1.1.0",
+		},
+		{
+			name: "cycle",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "1.0.0", dep("beta", "")),
+				kit("beta", "1.0.0", dep("gamma", "")),
+				kit("gamma", "1.0.0", dep("alpha", "")),
+			)},
+			roots: []string{"alpha"},
+			err:   "dependency cycle: kit alpha@1.0.0 -> kit beta@1.0.0 -> kit gamma@1.0.0 -> kit alpha@1.0.0",
+		},
+		{
+			name:    "yanked skipped",
+			indexes: map[string]*mored.Index{testRemote: kits(kit("alpha", "1.0.0"), yanked(kit("alpha", "1.1.0")))},
+			roots:   []string{"alpha"},
+			want:    map[string]string{"alpha": "1.0.0"},
+		},
+		{
+			name:    "only yanked",
+			indexes: map[string]*mored.Index{testRemote: kits(yanked(kit("alpha", "1.0.0")))},
+			roots:   []string{"alpha"},
+			err:     "kit alpha has only yanked versions",
+		},
+		{
+			name: "yanked listed",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "1.0.0"),
+				yanked(kit("alpha", "2.0.0")),
+			)},
+			roots: []string{"alpha@^2.0.0"},
+			err:   "available: 1.0.0\n  yanked: 2.0.0",
+		},
+		{
+			name: "platform skipped",
+			indexes: map[string]*mored.Index{testRemote: kits(
+				kit("alpha", "1.0.0"),
+				&mored.Chart{Name: "alpha", Version: "2.0.0", Os: []string{"plan9"}},
+			)},
+			roots: []string{"alpha"},
+			want:  map[string]string{"alpha": "1.0.0"},
+		},
+		{
+			name:    "no version for platform",
+			indexes: map[string]*mored.Index{testRemote: kits(&mored.Chart{Name: "alpha", Version: "1.0.0", Arch: []string{"mips"}})},
+			roots:   []string{"alpha"},
+			err:     "kit alpha has no version for",
+		},
+		{
+			name: "dependency on another remote",
+			indexes: map[string]*mored.Index{
+				testRemote:  kits(crossRemote, kit("lib", "9.0.0")),
+				otherRemote: kits(kit("lib", "1.0.0"), kit("lib", "1.3.0")),
+			},
+			roots: []string{"app"},
+			want:  map[string]string{"app": "1.0.0", "lib@" + otherRemote: "1.3.0"},
+		},
+		{
+			name:    "missing dependency",
+			indexes: map[string]*mored.Index{testRemote: kits(kit("alpha", "1.0.0", dep("beta", "")))},
+			roots:   []string{"alpha"},
+			err:     "kit beta not found in " + testRemote + " (>=0.0.0 required by kit alpha@1.0.0)",
+		},
+		{
+			name: "invalid index entry",
+			indexes: map[string]*mored.Index{testRemote: {Kits: map[string][]*mored.Chart{
+				"alpha": {kit("../../alpha", "1.0.0")},
+			}}},
+			roots: []string{"alpha"},
+			err:   "invalid kit entry",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := testResolver(c.indexes)
+			var roots []*requirement
+			for _, arg := range c.roots {
+				name, constraint, _ := strings.Cut(arg, "@")
+				if constraint == "" {
+					constraint = DefaultConstraint
+				}
+				roots = append(roots, &requirement{kind: mored.DefaultKitDist, name: name, remote: testRemote, constraint: constraint})
+			}
+			res, err := r.resolve(roots)
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err != "" && err == nil:
+				t.Fatalf("expected error containing %q", c.err)
+			case c.err != "" && !strings.Contains(err.Error(), c.err):
+				t.Fatalf("expected error containing %q, got:\n%v", c.err, err)
+			case c.err != "":
+				return
+			}
+			got := make(map[string]string)
+			for _, rc := range res.order() {
+				name := rc.chart.Name
+				if rc.remote != testRemote {
+					name += "@" + rc.remote
+				}
+				got[name] = rc.chart.Version
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("resolved %v, want %v", got, c.want)
+			}
+			for name, version := range c.want {
+				if got[name] != version {
+					t.Fatalf("resolved %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	r := testResolver(map[string]*mored.Index{testRemote: kits(
+		kit("app", "1.0.0", dep("beta", ""), dep("alpha", "")),
+		kit("beta", "1.0.0", dep("alpha", "")),
+		kit("alpha", "1.0.0"),
+	)})
+	res, err := r.resolve([]*requirement{{kind: mored.DefaultKitDist, name: "app", remote: testRemote, constraint: DefaultConstraint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, rc := range res.order() {
+		order = append(order, rc.chart.Name)
+	}
+	// dependencies are installed before the charts requiring them
+	if got := strings.Join(order, " "); got != "alpha beta app" {
+		t.Fatalf("install order %q, want %q", got, "alpha beta app")
+	}
+}
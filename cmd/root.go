@@ -15,6 +15,9 @@ type rootOpts struct {
 	dry     bool
 	version string
 	conf    string
+	output  string
+	repo    string
+	result  *result
 }
 type rootCmd struct {
 	*rootOpts
@@ -23,21 +26,48 @@ type rootCmd struct {
 
 func newRootCmd(version string) *rootCmd {
 	c := &rootCmd{
-		rootOpts: &rootOpts{version: version},
+		rootOpts: &rootOpts{version: version, result: newResult()},
 	}
 	c.cmd = &cobra.Command{
-		Use:           "mrd",
-		Short:         "mored command line tool",
+		Use:   "mrd",
+		Short: "mored command line tool",
+		Long: `mored command line tool, exit codes:
+  0 success
+  1 failure
+  2 config error
+  3 validation error
+  4 storage error
+  5 partial failure, some charts failed without --strict`,
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if c.output != OutputText && c.output != OutputJSON {
+				c.fail(configError("--output must be %s or %s", OutputText, OutputJSON))
+			}
+			c.result.Command = cmd.CommandPath()
+		},
 	}
 	c.cmd.PersistentFlags().BoolVarP(&c.dry, "dry-run", "", false, "dry run mode.")
+	c.cmd.PersistentFlags().StringVarP(&c.output, "output", "o", OutputText, "output format, text or json (one event per line, the last line is the result).")
+	c.cmd.PersistentFlags().StringVarP(&c.repo, "repo", "", "", "named repository to use, default is the default repository, see mrd repo.")
 	c.cmd.PersistentFlags().StringVarP(&c.conf, "config", "c", "", "config file (default is $HOME/.config/mored/config.toml)")
 
 	c.cmd.AddCommand(
 		newVersionCmd(c.rootOpts).cmd,
-		newOssCmd(c.rootOpts).cmd,
+		newOssCmd(c.rootOpts, false).cmd,
+		newS3Cmd(c.rootOpts, false).cmd,
+		newLocalCmd(c.rootOpts, false).cmd,
+		newRepoCmd(c.rootOpts).cmd,
 		newBuildCmd(c.rootOpts).cmd,
+		newInstallCmd(c.rootOpts).cmd,
+		newDepsCmd(c.rootOpts).cmd,
+		newIndexCmd(c.rootOpts).cmd,
+		newKeyCmd(c.rootOpts).cmd,
+		newYankCmd(c.rootOpts).cmd,
+		newDeprecateCmd(c.rootOpts).cmd,
+		newGcCmd(c.rootOpts).cmd,
+		newSearchCmd(c.rootOpts).cmd,
+		newInfoCmd(c.rootOpts).cmd,
 	)
 
 	return c
@@ -47,45 +77,85 @@ func Execute(version string) {
 	r := newRootCmd(version)
 	cobra.OnInitialize(r.initConfig)
 	if err := r.cmd.Execute(); err != nil {
-		color.Red("🔴 %s", err)
-		os.Exit(0)
+		r.fail(err)
 	}
+	r.finish()
+}
+func (r *rootOpts) message(format string, a ...interface{}) string {
+	return secrets.mask(fmt.Sprintf(format, a...))
 }
-
 func (r *rootOpts) tips(format string, a ...interface{}) {
-	color.Blue("🚀 "+format, a...)
+	msg := r.message(format, a...)
+	if r.json() {
+		r.event("tips", msg)
+		return
+	}
+	color.Blue("🚀 %s", msg)
 }
 func (r *rootOpts) info(format string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf("=> "+format, a...))
+	msg := r.message(format, a...)
+	if r.json() {
+		r.event("info", msg)
+		return
+	}
+	fmt.Println("=> " + msg)
 }
 func (r *rootOpts) warn(format string, a ...interface{}) {
-	color.Yellow(fmt.Sprintf(">> "+format, a...))
+	msg := r.message(format, a...)
+	r.collect(msg, "")
+	if r.json() {
+		r.event("warn", msg)
+		return
+	}
+	color.Yellow(">> %s", msg)
 }
 func (r *rootOpts) example(format string, a ...interface{}) {
-	color.Magenta("👉 "+format, a...)
+	msg := r.message(format, a...)
+	if r.json() {
+		r.event("example", msg)
+		return
+	}
+	color.Magenta("👉 %s", msg)
 }
 func (r *rootOpts) success(format string, a ...interface{}) {
-	color.Green("✅ "+format, a...)
+	msg := r.message(format, a...)
+	if r.json() {
+		r.event("success", msg)
+		return
+	}
+	color.Green("✅ %s", msg)
 }
 func (r *rootOpts) error(format string, a ...interface{}) {
-	color.Red("🔴 "+format, a...)
+	msg := r.message(format, a...)
+	r.collect("", msg)
+	if r.json() {
+		r.event("error", msg)
+		return
+	}
+	color.Red("🔴 %s", msg)
 }
 func (r *rootOpts) exit(format string, a ...interface{}) {
-	r.error(format, a...)
-	os.Exit(0)
+	r.fail(fmt.Errorf(format, a...))
 }
 func (r *rootOpts) hasErrExit(tip string, err error) {
 	if err != nil {
 		if tip != "" {
-			r.exit("%s: %s", tip, err.Error())
-		} else {
-			r.exit(err.Error())
+			err = fmt.Errorf("%s: %w", tip, err)
 		}
+		r.fail(err)
 	}
 }
+func (r *rootOpts) fail(err error) {
+	r.error("%s", err.Error())
+	r.result.Code = exitCode(err)
+	r.finish()
+	os.Exit(r.result.Code)
+}
 func (r *rootOpts) do(tip string, fc func()) {
-	if r.dry {
-		color.Magenta("🌈 %s", tip)
+	if r.dry && r.json() {
+		r.event("dry-run", r.message("%s", tip))
+	} else if r.dry {
+		color.Magenta("🌈 %s", r.message("%s", tip))
 	} else {
 		r.tips(tip)
 		fc()
@@ -107,7 +177,15 @@ func (r *rootOpts) initConfig() {
 		r.warn("load config failed: %s", err.Error())
 	}
 }
-func (r *rootOpts) saveConfig() {
+func (r *rootOpts) configDir() string {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return filepath.Dir(file)
+	}
+	home, err := homedir.Dir()
+	r.hasErrExit("access user dir failed", err)
+	return path.Join(home, "/.config/mored")
+}
+func (r *rootOpts) configFile() string {
 	file := viper.ConfigFileUsed()
 	if file == "" {
 		home, err := homedir.Dir()
@@ -121,5 +199,17 @@ func (r *rootOpts) saveConfig() {
 			_ = f.Close()
 		}
 	}
-	r.hasErrExit("save config failed", viper.WriteConfigAs(file))
+	return file
+}
+func (r *rootOpts) saveConfig() {
+	r.writeConfig(viper.AllSettings())
+}
+
+// writeConfig replaces the whole config file with settings, keys and secrets are moved to the credentials file.
+func (r *rootOpts) writeConfig(settings map[string]any) {
+	r.moveCredentials(settings)
+	v := viper.New()
+	v.SetConfigType("toml")
+	r.hasErrExit("save config failed", v.MergeConfigMap(settings))
+	r.hasErrExit("save config failed", v.WriteConfigAs(r.configFile()))
 }
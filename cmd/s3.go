@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zohu/reg"
+)
+
+type s3Opts struct {
+	*rootOpts
+	section   string
+	domain    string
+	endpoint  string
+	region    string
+	key       string
+	secret    string
+	bucket    string
+	prefix    string
+	pathStyle bool
+}
+
+func (s *s3Opts) Load() {
+	s.domain = viper.GetString(s.section + ".domain")
+	s.endpoint = viper.GetString(s.section + ".endpoint")
+	s.region = viper.GetString(s.section + ".region")
+	s.key, s.secret = s.credentials(s.section, s.endpoint)
+	s.bucket = viper.GetString(s.section + ".bucket")
+	s.prefix = viper.GetString(s.section + ".prefix")
+	s.pathStyle = viper.GetBool(s.section + ".path-style")
+	if s.endpoint == "" || s.bucket == "" || s.prefix == "" {
+		s.fail(configError("S3 configuration [%s] is incomplete, please use the mrd s3 or mrd repo add s3 [flags...] command.", s.section))
+	}
+	if s.key == "" || s.secret == "" {
+		s.fail(configError("no credentials for [%s], set %s and %s, a credential helper or the credentials file", s.section, credentialEnv(s.section, "key"), credentialEnv(s.section, "secret")))
+	}
+}
+func (s *s3Opts) Remote() string {
+	return fmt.Sprintf("%s/%s", viper.GetString(s.section+".domain"), viper.GetString(s.section+".prefix"))
+}
+func (s *s3Opts) Storage() (mored.Storage, error) {
+	return mored.NewS3Storage(mored.S3Config{
+		Endpoint:  s.endpoint,
+		Region:    s.region,
+		Key:       s.key,
+		Secret:    s.secret,
+		Bucket:    s.bucket,
+		Prefix:    s.prefix,
+		PathStyle: s.pathStyle,
+	})
+}
+
+type s3Cmd struct {
+	*s3Opts
+	cmd *cobra.Command
+}
+
+func newS3Cmd(opts *rootOpts, named bool) *s3Cmd {
+	c := &s3Cmd{
+		s3Opts: &s3Opts{rootOpts: opts, section: "s3"},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "s3",
+		Short: "s3 compatible (aws, minio, ceph) config for repository.",
+		Long: `the key and secret may be omitted when they come from the environment or a credential helper, example:
+  mrd s3 --endpoint http://minio:9000 --bucket mored --path-style --key ... --secret ...` + credentialsHelp,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c.section = c.configSection("s3", args)
+			if reg.String(c.domain).IsUrl().NotB() {
+				c.domain = c.defaultDomain()
+			}
+			c.save()
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.domain, "domain", "d", "", "s3 domain.")
+	c.cmd.Flags().StringVarP(&c.endpoint, "endpoint", "p", "", "s3 endpoint, http:// for plain connections.")
+	c.cmd.Flags().StringVarP(&c.region, "region", "r", "", "s3 region.")
+	c.cmd.Flags().StringVarP(&c.key, "key", "k", "", "s3 access key, saved to the credentials file.")
+	c.cmd.Flags().StringVarP(&c.secret, "secret", "s", "", "s3 secret key, saved to the credentials file.")
+	c.cmd.Flags().StringVarP(&c.bucket, "bucket", "b", "", "s3 bucket.")
+	c.cmd.Flags().StringVarP(&c.prefix, "prefix", "", "repo", "s3 prefix")
+	c.cmd.Flags().BoolVarP(&c.pathStyle, "path-style", "", false, "use path style bucket addressing (minio, ceph).")
+
+	_ = c.cmd.MarkFlagRequired("endpoint")
+	_ = c.cmd.MarkFlagRequired("bucket")
+
+	if named {
+		c.named(c.cmd)
+		return c
+	}
+	_ = viper.BindPFlag("s3.domain", c.cmd.Flags().Lookup("domain"))
+	_ = viper.BindPFlag("s3.endpoint", c.cmd.Flags().Lookup("endpoint"))
+	_ = viper.BindPFlag("s3.region", c.cmd.Flags().Lookup("region"))
+	_ = viper.BindPFlag("s3.key", c.cmd.Flags().Lookup("key"))
+	_ = viper.BindPFlag("s3.secret", c.cmd.Flags().Lookup("secret"))
+	_ = viper.BindPFlag("s3.bucket", c.cmd.Flags().Lookup("bucket"))
+	_ = viper.BindPFlag("s3.prefix", c.cmd.Flags().Lookup("prefix"))
+	_ = viper.BindPFlag("s3.path-style", c.cmd.Flags().Lookup("path-style"))
+	return c
+}
+
+func (c *s3Cmd) defaultDomain() string {
+	host, secure := mored.S3Endpoint(c.endpoint)
+	scheme := "https"
+	if !secure {
+		scheme = "http"
+	}
+	if c.pathStyle {
+		return fmt.Sprintf("%s://%s/%s", scheme, host, c.bucket)
+	}
+	return fmt.Sprintf("%s://%s.%s", scheme, c.bucket, host)
+}
+func (c *s3Cmd) save() {
+	viper.Set(c.section+".domain", c.domain)
+	viper.Set(c.section+".endpoint", c.endpoint)
+	viper.Set(c.section+".region", c.region)
+	viper.Set(c.section+".key", c.key)
+	viper.Set(c.section+".secret", c.secret)
+	viper.Set(c.section+".bucket", c.bucket)
+	viper.Set(c.section+".prefix", c.prefix)
+	viper.Set(c.section+".path-style", c.pathStyle)
+	c.setStorage(c.section, "s3")
+	c.saveConfig()
+}
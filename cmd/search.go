@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"slices"
+	"strings"
+	"time"
+)
+
+type searchCmd struct {
+	*resolveOpts
+	cmd *cobra.Command
+}
+
+func newSearchCmd(opts *rootOpts) *searchCmd {
+	c := &searchCmd{resolveOpts: newResolveOpts(opts)}
+	c.cmd = &cobra.Command{
+		Use:   "search <term>",
+		Short: "search kits and suites of the remote index.",
+		Long: `the term matches the name, full name, keywords and description of the latest version, example:
+  mrd search nginx
+  mrd search proxy --kind suite`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			remote := c.defaultRemote()
+			index, err := c.resolver().index(remote)
+			c.hasErrExit("search failed", storageError(err))
+			matches := index.Search(c.kind, args[0])
+			for _, m := range matches {
+				c.record("found", m.Kind, m.Chart).Remote = remote
+				line := fmt.Sprintf("%s %s@%s", m.Kind, m.Chart.Name, m.Chart.Version)
+				if m.Chart.FullName != "" && m.Chart.FullName != m.Chart.Name {
+					line = fmt.Sprintf("%s %s", line, m.Chart.FullName)
+				}
+				if m.Chart.Metadata != nil && m.Chart.Metadata.Description != "" {
+					line = fmt.Sprintf("%s - %s", line, m.Chart.Metadata.Description)
+				}
+				c.info("%s", line)
+			}
+			c.success("%d charts match %s", len(matches), args[0])
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.kind, "kind", "k", "", "search kit or suite only.")
+	c.cmd.Flags().StringVarP(&c.remote, "remote", "", "", "search http(s):// or file:// repository instead of the configured one.")
+	return c
+}
+
+type infoCmd struct {
+	*resolveOpts
+	cmd *cobra.Command
+}
+
+func newInfoCmd(opts *rootOpts) *infoCmd {
+	c := &infoCmd{resolveOpts: newResolveOpts(opts)}
+	c.cmd = &cobra.Command{
+		Use:   "info <name>",
+		Short: "print every version of a kit or suite of the remote index.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			remote := c.defaultRemote()
+			index, err := c.resolver().index(remote)
+			c.hasErrExit("info failed", storageError(err))
+			var found bool
+			for _, kind := range []string{mored.DefaultKitDist, mored.DefaultSuiteDist} {
+				charts := index.Charts(kind)[args[0]]
+				if len(charts) == 0 || (c.kind != "" && c.kind != kind) {
+					continue
+				}
+				found = true
+				c.print(kind, remote, charts)
+			}
+			if !found {
+				c.fail(validationError("%s not found in %s", args[0], remote))
+			}
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.kind, "kind", "k", "", "kit or suite, both are printed by default.")
+	c.cmd.Flags().StringVarP(&c.remote, "remote", "", "", "read http(s):// or file:// repository instead of the configured one.")
+	return c
+}
+
+func (c *infoCmd) print(kind, remote string, charts []*mored.Chart) {
+	latest := mored.Latest(charts)
+	c.tips("%s %s %s", kind, latest.Name, latest.FullName)
+	if md := latest.Metadata; md != nil {
+		if md.Description != "" {
+			c.info("description: %s", md.Description)
+		}
+		if len(md.Keywords) > 0 {
+			c.info("keywords: %s", strings.Join(md.Keywords, ", "))
+		}
+		for _, m := range md.Maintainers {
+			line := m.Name
+			if m.Email != "" {
+				line = fmt.Sprintf("%s <%s>", line, m.Email)
+			}
+			if m.Home != "" {
+				line = fmt.Sprintf("%s %s", line, m.Home)
+			}
+			c.info("maintainer: %s", line)
+		}
+	}
+	c.info("latest: %s", latest.Version)
+	sorted := slices.Clone(charts)
+	mored.SortCharts(sorted)
+	for _, ct := range sorted {
+		rc := c.record("found", kind, ct)
+		rc.Remote = remote
+		line := fmt.Sprintf("%s %s/%s", ct.Version, strings.Join(ct.Os, ","), strings.Join(ct.Arch, ","))
+		if ct.Yanked {
+			line += " yanked"
+		}
+		if ct.Deprecated != "" {
+			line = fmt.Sprintf("%s deprecated: %s", line, ct.Deprecated)
+		}
+		c.info("%s", line)
+		if md := ct.Metadata; md != nil {
+			c.info("  digest: %s", md.Digest)
+			c.info("  generated: %s", md.Generated.Format(time.RFC3339))
+			if md.Signer != "" {
+				c.info("  signer: %s", md.Signer)
+			}
+		}
+		c.depends(rc, remote, mored.DefaultKitDist, ct.DepKits)
+		c.depends(rc, remote, mored.DefaultSuiteDist, ct.DepSuites)
+	}
+	c.data(kind, sorted)
+}
+func (c *infoCmd) depends(rc *resultChart, remote, kind string, deps []*mored.Dependency) {
+	for _, dep := range deps {
+		rc.Deps = append(rc.Deps, fmt.Sprintf("%s %s@%s", kind, dep.Name, dep.Version))
+		line := fmt.Sprintf("  depends on %s %s %s", kind, dep.Name, dep.Version)
+		if dep.Remote != "" && strings.TrimSuffix(dep.Remote, "/") != remote {
+			line = fmt.Sprintf("%s from %s", line, dep.Remote)
+		}
+		c.info("%s", line)
+	}
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/zj-sh/mrd/pkg/mored"
+	"github.com/zj-sh/mrd/util"
+)
+
+const (
+	DefaultStorageDriver = "oss"
+)
+
+type driver interface {
+	Load()
+	Remote() string
+	Storage() (mored.Storage, error)
+}
+
+type storeOpts struct {
+	*rootOpts
+	name    string
+	pinned  string
+	drv     driver
+	storage mored.Storage
+	signer  ed25519.PrivateKey
+}
+
+func newStoreOpts(opts *rootOpts) *storeOpts {
+	return &storeOpts{rootOpts: opts}
+}
+func newDriver(opts *rootOpts, storage, section string) (driver, bool) {
+	switch storage {
+	case "oss":
+		return &ossOpts{rootOpts: opts, section: section}, true
+	case "s3":
+		return &s3Opts{rootOpts: opts, section: section}, true
+	case "local":
+		return &localOpts{rootOpts: opts, section: section}, true
+	}
+	return nil, false
+}
+
+// repoName is the pinned repository, the --repo flag or the default repository, empty for the single
+// repository configured by mrd oss, s3 or local.
+func (s *storeOpts) repoName() string {
+	return util.FirstTruthValue(s.pinned, s.repo, viper.GetString(DefaultRepoKey))
+}
+func (s *storeOpts) driver() driver {
+	if s.drv != nil {
+		return s.drv
+	}
+	name := util.FirstTruthValue(viper.GetString("storage"), DefaultStorageDriver)
+	section := name
+	if repo := s.repoName(); repo != "" {
+		section = repoSection(repo)
+		if !viper.IsSet(section) {
+			s.fail(configError("repository %s is not registered, see mrd repo list", repo))
+		}
+		name = viper.GetString(section + ".storage")
+	}
+	d, ok := newDriver(s.rootOpts, name, section)
+	if !ok {
+		s.fail(configError("unsupported storage driver %s", name))
+	}
+	s.name, s.drv = name, d
+	return d
+}
+func (s *storeOpts) Load() {
+	s.driver().Load()
+	if id := viper.GetString("sign.key"); id != "" && s.signer == nil {
+		priv, err := s.signingKey(id)
+		s.hasErrExit("load signing key failed", withCode(ExitConfig, err))
+		s.signer = priv
+	}
+}
+func (s *storeOpts) Remote() string {
+	return s.driver().Remote()
+}
+func (s *storeOpts) Storage() mored.Storage {
+	if s.storage == nil {
+		st, err := s.driver().Storage()
+		s.hasErrExit(fmt.Sprintf("failed to initialize %s storage", s.name), storageError(err))
+		s.storage = st
+	}
+	return s.storage
+}
+func (s *storeOpts) publisher() *mored.Publisher {
+	return &mored.Publisher{
+		Storage:  s.Storage(),
+		Signer:   s.signer,
+		Uploaded: func(name string) { s.uploaded(name) },
+		Warnf:    s.warn,
+	}
+}
+func (s *storeOpts) readIndex() (*mored.Index, string) {
+	index, etag, err := s.publisher().ReadIndex(false)
+	s.hasErrExit("failed to load remote index", storageError(err))
+	return index, etag
+}
+func (s *storeOpts) updateIndex(fc func(index *mored.Index)) []byte {
+	return s.writeIndex(s.publisher(), false, fc)
+}
+
+// replaceIndex is updateIndex for recovery, it also overwrites an index that cannot be parsed.
+func (s *storeOpts) replaceIndex(fc func(index *mored.Index)) []byte {
+	return s.writeIndex(s.publisher(), true, fc)
+}
+func (s *storeOpts) writeIndex(p *mored.Publisher, tolerant bool, fc func(index *mored.Index)) []byte {
+	d, err := p.UpdateIndex(tolerant, func(index *mored.Index) error {
+		fc(index)
+		return nil
+	})
+	s.hasErrExit("push index failed", storageError(err))
+	return d
+}
+func (s *storeOpts) remotes() map[string]string {
+	remotes := make(map[string]string)
+	for _, name := range registeredRepos() {
+		if d, ok := newDriver(s.rootOpts, viper.GetString(repoSection(name)+".storage"), repoSection(name)); ok {
+			remotes[name] = d.Remote()
+		}
+	}
+	return remotes
+}
+func (s *storeOpts) registered(remote string) *storeOpts {
+	for name, r := range s.remotes() {
+		if r == remote {
+			st := newStoreOpts(s.rootOpts)
+			st.pinned = name
+			st.Load()
+			return st
+		}
+	}
+	return nil
+}
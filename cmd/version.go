@@ -23,7 +23,10 @@ func newVersionCmd(opts *rootOpts) *versionCmd {
 		Short: "Print the version number",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			color.Blue(c.version)
+			c.data("version", c.version)
+			if !c.json() {
+				color.Blue(c.version)
+			}
 		},
 	}
 	return c
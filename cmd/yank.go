@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zj-sh/mrd/pkg/mored"
+)
+
+type yankOpts struct {
+	*buildOpts
+	message string
+	undo    bool
+}
+
+type yankCmd struct {
+	*yankOpts
+	cmd *cobra.Command
+}
+
+func newYankCmd(opts *rootOpts) *yankCmd {
+	c := &yankCmd{
+		yankOpts: &yankOpts{buildOpts: &buildOpts{rootOpts: opts, store: newStoreOpts(opts)}},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "yank <kit|suite> <name> <version>",
+		Short: "retract a published version, the archive is kept.",
+		Long: `yanked versions are skipped when resolving, unless pinned by Mored.lock, example:
+  mrd yank kit hello 1.2.0
+  mrd yank kit hello 1.2.0 --undo`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			c.mark(c.status("yanked"), args[0], args[1], args[2], func(chart *mored.Chart) {
+				chart.Yanked = !c.undo
+			})
+		},
+	}
+	c.cmd.Flags().BoolVarP(&c.undo, "undo", "", false, "restore a yanked version.")
+	return c
+}
+
+type deprecateCmd struct {
+	*yankOpts
+	cmd *cobra.Command
+}
+
+func newDeprecateCmd(opts *rootOpts) *deprecateCmd {
+	c := &deprecateCmd{
+		yankOpts: &yankOpts{buildOpts: &buildOpts{rootOpts: opts, store: newStoreOpts(opts)}},
+	}
+	c.cmd = &cobra.Command{
+		Use:   "deprecate <kit|suite> <name> <version>",
+		Short: "mark a published version as deprecated, it can still be installed.",
+		Long: `the message is printed whenever the version is resolved, example:
+  mrd deprecate kit hello 1.2.0 --message "use 2.x instead"`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			if c.message == "" && !c.undo {
+				c.exit("missing --message")
+			}
+			c.mark(c.status("deprecated"), args[0], args[1], args[2], func(chart *mored.Chart) {
+				chart.Deprecated = c.message
+				if c.undo {
+					chart.Deprecated = ""
+				}
+			})
+		},
+	}
+	c.cmd.Flags().StringVarP(&c.message, "message", "m", "", "why the version is deprecated.")
+	c.cmd.Flags().BoolVarP(&c.undo, "undo", "", false, "remove the deprecation.")
+	return c
+}
+
+func (c *yankOpts) status(done string) string {
+	if c.undo {
+		return "restored"
+	}
+	return done
+}
+func (c *yankOpts) mark(status, kind, name, version string, fc func(chart *mored.Chart)) {
+	if kind != mored.DefaultKitDist && kind != mored.DefaultSuiteDist {
+		c.exit("kind must be %s or %s", mored.DefaultKitDist, mored.DefaultSuiteDist)
+	}
+	c.store.Load()
+	c.do(fmt.Sprintf("updating %s %s@%s...", kind, name, version), func() {
+		author := mored.NewAuthor()
+		var updated *mored.Chart
+		c.store.updateIndex(func(index *mored.Index) {
+			if updated = index.Find(kind, name, version); updated == nil {
+				c.exit("%s %s@%s not found in %s", kind, name, version, c.store.Remote())
+			}
+			fc(updated)
+			index.MergeAuthor(author)
+		})
+		c.record(status, kind, updated)
+		c.success("%s %s@%s %s", kind, name, version, status)
+	})
+}
@@ -0,0 +1,34 @@
+package mored
+
+import (
+	"github.com/zj-sh/mrd/util"
+	"os"
+	"path"
+	"time"
+)
+
+// BuildArchive compresses src into the archive of chart under dist and stamps the chart with its digest,
+// the paths left out by ignore are returned.
+func BuildArchive(kind, src, dist string, ignore *util.Ignore, chart *Chart, algorithm string) ([]string, error) {
+	gzFile := path.Join(dist, ChartObject(kind, chart))
+	if err := os.MkdirAll(path.Dir(gzFile), os.ModePerm); err != nil {
+		return nil, err
+	}
+	excluded, err := util.Compress(src, gzFile, ignore)
+	if err != nil {
+		return excluded, err
+	}
+	digest, err := util.FileDigest(gzFile, algorithm)
+	if err != nil {
+		return excluded, err
+	}
+	Stamp(chart, digest)
+	return excluded, nil
+}
+func Stamp(chart *Chart, digest string) {
+	if chart.Metadata == nil {
+		chart.Metadata = &Metadata{}
+	}
+	chart.Metadata.Digest = digest
+	chart.Metadata.Generated = time.Now()
+}
@@ -0,0 +1,220 @@
+package mored
+
+import (
+	"fmt"
+	"github.com/zj-sh/mrd/util"
+	"github.com/zohu/reg"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultChartFile           = "Mored.yaml"
+	DefaultIgnoreFile          = ".mredignore"
+	DefaultKitDist             = "kit"
+	DefaultKitMainFile         = "kit.sh"
+	DefaultSuiteDist           = "suite"
+	DefaultSuiteMainFile       = "suite"
+	DefaultSuitePattern        = `^suite(\.\w+)?$`
+	DefaultSuiteCommandPattern = `(^@$)|(^@\x20.*)|(.*\x20@$)|(.*\x20@\x20.*)`
+)
+
+type Dependency struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Remote  string `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+type Maintainer struct {
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+	Home  string `json:"home,omitempty" yaml:"home,omitempty"`
+}
+type Metadata struct {
+	Icon        string        `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Description string        `json:"description,omitempty" yaml:"description,omitempty"`
+	Digest      string        `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Signer      string        `json:"signer,omitempty" yaml:"signer,omitempty"`
+	Keywords    []string      `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Maintainers []*Maintainer `json:"maintainers,omitempty" yaml:"maintainers,omitempty"`
+	Generated   time.Time     `json:"generated,omitempty" yaml:"generated,omitempty"`
+}
+type Chart struct {
+	Name         string        `json:"name,omitempty" yaml:"name,omitempty"`
+	FullName     string        `json:"fullName,omitempty" yaml:"fullName,omitempty"`
+	Version      string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Command      string        `json:"command,omitempty" yaml:"command,omitempty"`
+	MoredVersion string        `json:"moredVersion,omitempty" yaml:"moredVersion,omitempty"`
+	Os           []string      `json:"os,omitempty,omitempty" yaml:"os,omitempty,omitempty"`
+	Arch         []string      `json:"arch,omitempty" yaml:"arch,omitempty"`
+	Effects      []int64       `json:"effects,omitempty" yaml:"effects,omitempty"`
+	DepKits      []*Dependency `json:"depKits,omitempty" yaml:"depKits,omitempty"`
+	DepSuites    []*Dependency `json:"depSuites,omitempty" yaml:"depSuites,omitempty"`
+	Exclude      []string      `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Yanked       bool          `json:"yanked,omitempty" yaml:"yanked,omitempty"`
+	Deprecated   string        `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Metadata     *Metadata     `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// LoadChart reads and validates the chart of a kit or suite directory, dependencies without
+// a remote default to remote, repos maps repository names usable as dependency remotes to addresses.
+func LoadChart(kind, dir, remote string, repos map[string]string) (*Chart, *util.Ignore, error) {
+	chart, err := ReadChart(path.Join(dir, DefaultChartFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("load Mored.yaml failed. %s", err.Error())
+	}
+	ignore, err := ChartIgnore(dir, chart.Exclude)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load %s failed. %s", DefaultIgnoreFile, err.Error())
+	}
+	ResolveRemotes(chart, repos)
+	switch kind {
+	case DefaultKitDist:
+		chart, err = KitChart(chart, remote)
+	case DefaultSuiteDist:
+		chart, err = SuiteChart(chart, remote)
+	default:
+		err = fmt.Errorf("kind must be %s or %s", DefaultKitDist, DefaultSuiteDist)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return chart, ignore, nil
+}
+func ReadChart(filename string) (*Chart, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	d, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChart(d)
+}
+func ParseChart(d []byte) (*Chart, error) {
+	var chart Chart
+	if err := yaml.Unmarshal(d, &chart); err != nil {
+		return nil, err
+	}
+	return &chart, nil
+}
+
+// ChartIgnore combines the .mredignore of dir with the exclude list of its Mored.yaml, which itself is always kept.
+func ChartIgnore(dir string, exclude []string) (*util.Ignore, error) {
+	return util.LoadIgnore(path.Join(dir, DefaultIgnoreFile), append(slices.Clone(exclude), "!/"+DefaultChartFile)...)
+}
+func KitChart(chart *Chart, remote string) (*Chart, error) {
+	if err := Verify(chart, remote); err != nil {
+		return nil, err
+	}
+	return &Chart{
+		Name:         chart.Name,
+		FullName:     util.FirstTruthValue(chart.FullName, chart.Name),
+		Version:      chart.Version,
+		MoredVersion: util.FirstTruthValue(chart.MoredVersion, ">=0.0.0"),
+		Os:           util.FirstTruthValue(chart.Os, []string{"linux", "darwin"}),
+		Arch:         util.FirstTruthValue(chart.Arch, []string{"amd64", "arm64"}),
+		DepKits:      chart.DepKits,
+		Metadata:     chart.Metadata,
+	}, nil
+}
+func SuiteChart(chart *Chart, remote string) (*Chart, error) {
+	if err := Verify(chart, remote); err != nil {
+		return nil, err
+	}
+	if reg.String(chart.Command).Match(DefaultSuiteCommandPattern).AllowZero().NotB() {
+		return nil, fmt.Errorf("command must not contain the @ symbol")
+	}
+	if len(chart.Effects) == 0 {
+		return nil, fmt.Errorf("effects is required")
+	}
+	return &Chart{
+		Name:         chart.Name,
+		FullName:     util.FirstTruthValue(chart.FullName, chart.Name),
+		Version:      chart.Version,
+		MoredVersion: util.FirstTruthValue(chart.MoredVersion, ">=0.0.0"),
+		Command:      util.FirstTruthValue(chart.Command, "@"),
+		Effects:      chart.Effects,
+		Os:           util.FirstTruthValue(chart.Os, []string{"linux", "darwin"}),
+		Arch:         util.FirstTruthValue(chart.Arch, []string{"amd64", "arm64"}),
+		DepKits:      chart.DepKits,
+		DepSuites:    chart.DepSuites,
+		Metadata:     chart.Metadata,
+	}, nil
+}
+
+// Verify checks the fields shared by kits and suites, dependencies without a remote default to remote.
+func Verify(ct *Chart, remote string) error {
+	if err := VerifyName(ct.Name); err != nil {
+		return err
+	}
+	if reg.String(ct.FullName).MaxLen(128).AllowEmpty().NotB() {
+		return fmt.Errorf("full name maximum length of 128 digits")
+	}
+	if reg.Version(ct.Version).IsVersion().NotB() {
+		return fmt.Errorf("incorrect version format, only supports x.x.x standard formats")
+	}
+	if reg.Version(ct.MoredVersion).IsVersionSupport().AllowEmpty().NotB() {
+		return fmt.Errorf("mored version supports prefixes: (~) patch, (^) minor, (>=) greater than or equal to, (<=) less than or equal to, default >= 0.0.0")
+	}
+	for i, dep := range ct.DepKits {
+		if reg.Version(dep.Version).IsVersionSupport().NotB() {
+			return fmt.Errorf("dep kit %s version supports prefixes: (~) patch, (^) minor, (>=) greater than or equal to, (<=) less than or equal to, default >= 0.0.0", dep.Name)
+		}
+		if !IsRemote(dep.Remote) {
+			return fmt.Errorf("dep kit %s repository address error, only domains starting with http(s):// or file:// are supported", dep.Name)
+		}
+		ct.DepKits[i].Remote = util.FirstTruthValue(dep.Remote, remote)
+	}
+	for i, dep := range ct.DepSuites {
+		if reg.Version(dep.Version).IsVersionSupport().NotB() {
+			return fmt.Errorf("dep suite %s version supports prefixes: (~) patch, (^) minor, (>=) greater than or equal to, (<=) less than or equal to, default >= 0.0.0", dep.Name)
+		}
+		if !IsRemote(dep.Remote) {
+			return fmt.Errorf("dep suite %s repository address error, only domains starting with http(s):// or file:// are supported", dep.Name)
+		}
+		ct.DepSuites[i].Remote = util.FirstTruthValue(dep.Remote, remote)
+	}
+	return nil
+}
+
+// VerifyName checks a chart name, names are used as path elements when installing.
+func VerifyName(name string) error {
+	if reg.String(name).IsTruthAlphanumericUnderline().NotB() {
+		return fmt.Errorf("name can only contain letters, numbers, underscores, the first can not be a number, maximum length of 128 digits")
+	}
+	return nil
+}
+
+// ResolveRemotes replaces the dependency remotes naming one of repos with its address.
+func ResolveRemotes(ct *Chart, repos map[string]string) {
+	for _, dep := range slices.Concat(ct.DepKits, ct.DepSuites) {
+		if remote, ok := repos[dep.Remote]; ok && dep.Remote != "" {
+			dep.Remote = remote
+		}
+	}
+}
+func IsRemote(remote string) bool {
+	return remote == "" || strings.HasPrefix(remote, "file://") || reg.String(remote).IsUrl().B()
+}
+func ChartFileName(args ...string) string {
+	var name string
+	for _, s := range args {
+		s = strings.TrimSpace(s)
+		s = util.CamelCaseToUnderscore(s)
+		name = fmt.Sprintf("%s_%s", name, s)
+	}
+	return strings.TrimPrefix(name, "_")
+}
+func ChartObject(kind string, chart *Chart) string {
+	return fmt.Sprintf("%s/%s.tar.gz", kind, ChartFileName(chart.Name, chart.Version))
+}
+func ChartDigest(chart *Chart) string {
+	if chart.Metadata == nil {
+		return ""
+	}
+	return chart.Metadata.Digest
+}
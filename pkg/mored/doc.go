@@ -0,0 +1,10 @@
+// Package mored loads, builds and publishes kits and suites, the mrd command is a thin layer on top of it.
+//
+// Publishing a kit from a service:
+//
+//	st, err := mored.NewLocalStorage("/srv/repo")
+//	chart, ignore, err := mored.LoadChart(mored.DefaultKitDist, "hello", "https://repo.example.com", nil)
+//	_, err = mored.BuildArchive(mored.DefaultKitDist, "hello", "dist", ignore, chart, util.DigestSHA256)
+//	p := &mored.Publisher{Storage: st, Dist: "dist", Jobs: 4}
+//	published, index, err := p.Publish(mored.DefaultKitDist, map[string][]*mored.Chart{chart.Name: {chart}}, mored.NewAuthor())
+package mored
@@ -0,0 +1,173 @@
+package mored
+
+import (
+	"fmt"
+	"github.com/zj-sh/mrd/util"
+	"github.com/zohu/reg"
+	"gopkg.in/yaml.v3"
+	"os/user"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultIndexVersion = "v1"
+	DefaultIndexFile    = "index.yaml"
+	DefaultIndexAuthors = 5
+)
+
+type Author struct {
+	Name      string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Platform  string    `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Ip        string    `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Generated time.Time `json:"generated,omitempty" yaml:"generated,omitempty"`
+}
+type Replacement struct {
+	Kind     string    `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Name     string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Version  string    `json:"version,omitempty" yaml:"version,omitempty"`
+	From     string    `json:"from,omitempty" yaml:"from,omitempty"`
+	To       string    `json:"to,omitempty" yaml:"to,omitempty"`
+	Author   string    `json:"author,omitempty" yaml:"author,omitempty"`
+	Replaced time.Time `json:"replaced,omitempty" yaml:"replaced,omitempty"`
+}
+type Index struct {
+	Version string              `json:"version,omitempty" yaml:"version,omitempty"`
+	Digests []string            `json:"digests,omitempty" yaml:"digests,omitempty"`
+	Suites  map[string][]*Chart `json:"suites,omitempty" yaml:"suites,omitempty"`
+	Kits    map[string][]*Chart `json:"kits,omitempty" yaml:"kits,omitempty"`
+	Authors []*Author           `json:"authors,omitempty" yaml:"authors,omitempty"`
+	History []*Replacement      `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+func NewIndex() *Index {
+	return &Index{
+		Version: DefaultIndexVersion,
+		Kits:    make(map[string][]*Chart),
+		Suites:  make(map[string][]*Chart),
+		Authors: []*Author{},
+	}
+}
+func NewAuthor() *Author {
+	now := &Author{
+		Name:      "unknown",
+		Ip:        util.NetIp(),
+		Platform:  runtime.GOOS,
+		Generated: time.Now(),
+	}
+	if u, err := user.Current(); err == nil {
+		now.Name = util.FirstTruthValue(u.Username, u.Name)
+	}
+	return now
+}
+func LoadIndex(st Storage) (*Index, error) {
+	d, err := ReadObject(st, DefaultIndexFile)
+	if err != nil {
+		return NewIndex(), err
+	}
+	return ParseIndex(d)
+}
+func ParseIndex(d []byte) (*Index, error) {
+	index := NewIndex()
+	if err := yaml.Unmarshal(d, index); err != nil {
+		return index, fmt.Errorf("%w: %s", ErrIndexCorrupted, err.Error())
+	}
+	return index, nil
+}
+func (idx *Index) Charts(kind string) map[string][]*Chart {
+	if kind == DefaultSuiteDist {
+		return idx.Suites
+	}
+	return idx.Kits
+}
+func (idx *Index) Find(kind, name, version string) *Chart {
+	charts := idx.Charts(kind)[name]
+	if i := slices.IndexFunc(charts, func(ct *Chart) bool { return ct.Version == version }); i >= 0 {
+		return charts[i]
+	}
+	return nil
+}
+func (idx *Index) DigestAlgorithms() []string {
+	var algorithms []string
+	for _, charts := range []map[string][]*Chart{idx.Kits, idx.Suites} {
+		for _, cts := range charts {
+			for _, ct := range cts {
+				if a := util.DigestAlgorithm(ChartDigest(ct)); a != "" && !slices.Contains(algorithms, a) {
+					algorithms = append(algorithms, a)
+				}
+			}
+		}
+	}
+	slices.Sort(algorithms)
+	return algorithms
+}
+
+// MergeAuthor puts now in front of the latest authors of the index.
+func (idx *Index) MergeAuthor(now *Author) {
+	authors := []*Author{now}
+	for i := 0; i < DefaultIndexAuthors-1 && i < len(idx.Authors); i++ {
+		authors = append(authors, idx.Authors[i])
+	}
+	idx.Authors = authors
+}
+
+// SortCharts orders charts from the highest version to the lowest.
+func SortCharts(charts []*Chart) {
+	slices.SortFunc(charts, func(a, b *Chart) int {
+		if reg.Version(a.Version).HighThan(b.Version).B() {
+			return -1
+		}
+		if reg.Version(a.Version).LowThan(b.Version).B() {
+			return 1
+		}
+		return 0
+	})
+}
+
+type Match struct {
+	Kind  string
+	Chart *Chart
+}
+
+// Search finds the charts of kind whose name, full name, keywords or description contain term, ignoring case,
+// an empty kind searches kits and suites. Only the latest version of a chart is matched, yanked versions
+// are skipped unless every version is yanked.
+func (idx *Index) Search(kind, term string) []*Match {
+	term = strings.ToLower(term)
+	var matches []*Match
+	for _, k := range []string{DefaultKitDist, DefaultSuiteDist} {
+		if kind != "" && kind != k {
+			continue
+		}
+		charts := idx.Charts(k)
+		for _, name := range util.SortedKeys(charts) {
+			if latest := Latest(charts[name]); latest != nil && latest.matches(term) {
+				matches = append(matches, &Match{Kind: k, Chart: latest})
+			}
+		}
+	}
+	return matches
+}
+func (ct *Chart) matches(term string) bool {
+	fields := []string{ct.Name, ct.FullName}
+	if ct.Metadata != nil {
+		fields = append(fields, ct.Metadata.Description)
+		fields = append(fields, ct.Metadata.Keywords...)
+	}
+	return slices.ContainsFunc(fields, func(f string) bool { return strings.Contains(strings.ToLower(f), term) })
+}
+
+// Latest returns the highest version of charts which is not yanked, or the highest one when all are yanked.
+func Latest(charts []*Chart) *Chart {
+	if len(charts) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(charts)
+	SortCharts(sorted)
+	if i := slices.IndexFunc(sorted, func(ct *Chart) bool { return !ct.Yanked }); i >= 0 {
+		return sorted[i]
+	}
+	return sorted[0]
+}
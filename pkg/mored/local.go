@@ -0,0 +1,174 @@
+package mored
+
+import (
+	"github.com/zj-sh/mrd/util"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewLocalStorage opens a repository stored in a plain directory, it is created when missing.
+func NewLocalStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &localStorage{dir: dir}, nil
+}
+
+// LocalRoot accepts both file:// urls and plain paths.
+func LocalRoot(root string) string {
+	root = strings.TrimPrefix(root, "file://")
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return root
+}
+
+type localStorage struct {
+	dir string
+}
+
+func (s *localStorage) filename(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(filepath.Clean("/"+name)))
+}
+func (s *localStorage) error(err error) error {
+	if os.IsNotExist(err) {
+		return ErrObjectNotExist
+	}
+	return err
+}
+func (s *localStorage) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(s.filename(name))
+	return f, s.error(err)
+}
+func (s *localStorage) Put(name string, r io.Reader) error {
+	filename := s.filename(name)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+func (s *localStorage) PutIf(name string, r io.Reader, etag string) error {
+	unlock, err := s.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = CheckETag(s, name, etag); err != nil {
+		return err
+	}
+	return s.Put(name, r)
+}
+
+// lock takes an exclusive lock file next to name, stale locks expire after DefaultLockExpiry. Every lock
+// holds a unique token and is only removed while it still holds the token, so a live lock taken in between
+// is never lost.
+func (s *localStorage) lock(name string) (func(), error) {
+	filename := s.filename(name) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	token := strconv.FormatInt(rand.Int63(), 36)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.WriteString(token)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(filename)
+			return nil, err
+		}
+		return func() { s.release(filename, token) }, nil
+	}
+	if !os.IsExist(err) {
+		return nil, err
+	}
+	if fi, err := os.Stat(filename); err == nil && time.Since(fi.ModTime()) > DefaultLockExpiry {
+		if d, err := os.ReadFile(filename); err == nil {
+			s.release(filename, string(d))
+		}
+	}
+	return nil, ErrConflict
+}
+
+// release moves the lock aside before removing it, a lock that no longer holds token is put back.
+func (s *localStorage) release(filename, token string) {
+	moved := filename + "." + strconv.FormatInt(rand.Int63(), 36) + ".lock"
+	if err := os.Rename(filename, moved); err != nil {
+		return
+	}
+	if d, err := os.ReadFile(moved); err == nil && string(d) != token {
+		_ = os.Link(moved, filename)
+	}
+	_ = os.Remove(moved)
+}
+
+// Stat hashes the content for the ETag, timestamps are too coarse on some filesystems to tell two writes apart.
+func (s *localStorage) Stat(name string) (*Object, error) {
+	filename := s.filename(name)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, s.error(err)
+	}
+	etag, err := util.FileDigest(filename, util.DigestSHA256)
+	if err != nil {
+		return nil, s.error(err)
+	}
+	obj := s.object(name, fi)
+	obj.ETag = etag
+	return obj, nil
+}
+func (s *localStorage) object(name string, fi fs.FileInfo) *Object {
+	return &Object{Name: name, Size: fi.Size(), Modified: fi.ModTime()}
+}
+
+// List leaves the ETag empty, hashing every archive is too slow.
+func (s *localStorage) List(prefix string) ([]*Object, error) {
+	var objs []*Object
+	err := filepath.WalkDir(s.filename(prefix), func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") || strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, filename)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objs = append(objs, s.object(filepath.ToSlash(rel), fi))
+		return nil
+	})
+	return objs, err
+}
+func (s *localStorage) Delete(name string) error {
+	return s.error(os.Remove(s.filename(name)))
+}
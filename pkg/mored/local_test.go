@@ -0,0 +1,69 @@
+package mored
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalPutIf(t *testing.T) {
+	st, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutIf("a", strings.NewReader("one"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutIf("a", strings.NewReader("two"), ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("create over an existing object: %v", err)
+	}
+	obj, err := st.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same size and likely the same mtime, only the content differs
+	if err = st.PutIf("a", strings.NewReader("two"), obj.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutIf("a", strings.NewReader("six"), obj.ETag); !errors.Is(err, ErrConflict) {
+		t.Fatalf("write with a stale etag: %v", err)
+	}
+}
+
+func TestLocalLock(t *testing.T) {
+	s := &localStorage{dir: t.TempDir()}
+	unlock, err := s.lock("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.lock("a"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("lock of a held lock: %v", err)
+	}
+	filename := s.filename("a") + ".lock"
+	old := time.Now().Add(-2 * DefaultLockExpiry)
+	if err = os.Chtimes(filename, old, old); err != nil {
+		t.Fatal(err)
+	}
+	// the stale lock is removed and the next attempt wins
+	if _, err = s.lock("a"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("lock over a stale lock: %v", err)
+	}
+	live, err := s.lock("a")
+	if err != nil {
+		t.Fatalf("lock after stale cleanup: %v", err)
+	}
+	// the first holder returns late, it must not release the lock that replaced its own
+	unlock()
+	if _, err = s.lock("a"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("a late unlock released a live lock: %v", err)
+	}
+	live()
+	if _, err = s.lock("a"); err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 1 {
+		t.Fatalf("expected only the lock file, got %d entries", len(entries))
+	}
+}
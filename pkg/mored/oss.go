@@ -0,0 +1,139 @@
+package mored
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OSSConfig struct {
+	Endpoint string
+	Key      string
+	Secret   string
+	Bucket   string
+	Prefix   string
+}
+
+func NewOSSStorage(conf OSSConfig) (Storage, error) {
+	clt, err := oss.New(conf.Endpoint, conf.Key, conf.Secret)
+	if err != nil {
+		return nil, err
+	}
+	bkt, err := clt.Bucket(conf.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &ossStorage{bkt: bkt, prefix: conf.Prefix}, nil
+}
+
+type ossStorage struct {
+	bkt    *oss.Bucket
+	prefix string
+}
+
+func (s *ossStorage) error(err error) error {
+	var se oss.ServiceError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return ErrObjectNotExist
+	}
+	return err
+}
+func (s *ossStorage) Get(name string) (io.ReadCloser, error) {
+	r, err := s.bkt.GetObject(objectKey(s.prefix, name))
+	return r, s.error(err)
+}
+func (s *ossStorage) Put(name string, r io.Reader) error {
+	return s.bkt.PutObject(objectKey(s.prefix, name), r)
+}
+func (s *ossStorage) PutIf(name string, r io.Reader, etag string) error {
+	unlock, err := s.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = CheckETag(s, name, etag); err != nil {
+		return err
+	}
+	return s.Put(name, r)
+}
+
+// lock creates a lock object that must not exist yet, stale locks expire after DefaultLockExpiry.
+// Every lock holds a unique token, so its ETag tells a stale lock from the one that replaced it.
+func (s *ossStorage) lock(name string) (func(), error) {
+	key := objectKey(s.prefix, name+".lock")
+	token := fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63())
+	var h http.Header
+	err := s.bkt.PutObject(key, strings.NewReader(token), oss.ForbidOverWrite(true), oss.GetResponseHeader(&h))
+	if err == nil {
+		etag := h.Get(oss.HTTPHeaderEtag)
+		return func() { s.release(key, etag) }, nil
+	}
+	var se oss.ServiceError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusConflict {
+		return nil, err
+	}
+	if h, err := s.bkt.GetObjectDetailedMeta(key); err == nil {
+		if modified, err := http.ParseTime(h.Get(oss.HTTPHeaderLastModified)); err == nil && time.Since(modified) > DefaultLockExpiry {
+			s.release(key, h.Get(oss.HTTPHeaderEtag))
+		}
+	}
+	return nil, ErrConflict
+}
+
+// release deletes the lock key only while it is still the object with etag.
+func (s *ossStorage) release(key, etag string) {
+	if etag == "" {
+		return
+	}
+	h, err := s.bkt.GetObjectDetailedMeta(key)
+	if err != nil || h.Get(oss.HTTPHeaderEtag) != etag {
+		return
+	}
+	_ = s.bkt.DeleteObject(key, oss.IfMatch(etag))
+}
+func (s *ossStorage) Stat(name string) (*Object, error) {
+	h, err := s.bkt.GetObjectDetailedMeta(objectKey(s.prefix, name))
+	if err != nil {
+		return nil, s.error(err)
+	}
+	size, _ := strconv.ParseInt(h.Get(oss.HTTPHeaderContentLength), 10, 64)
+	modified, _ := http.ParseTime(h.Get(oss.HTTPHeaderLastModified))
+	return &Object{
+		Name:     name,
+		Size:     size,
+		ETag:     h.Get(oss.HTTPHeaderEtag),
+		Modified: modified,
+	}, nil
+}
+func (s *ossStorage) List(prefix string) ([]*Object, error) {
+	var objs []*Object
+	root := objectKey(s.prefix, "") + "/"
+	opts := []oss.Option{oss.Prefix(objectKey(s.prefix, prefix))}
+	for {
+		res, err := s.bkt.ListObjectsV2(opts...)
+		if err != nil {
+			return nil, s.error(err)
+		}
+		for _, o := range res.Objects {
+			objs = append(objs, &Object{
+				Name:     strings.TrimPrefix(o.Key, root),
+				Size:     o.Size,
+				ETag:     o.ETag,
+				Modified: o.LastModified,
+			})
+		}
+		if !res.IsTruncated {
+			return objs, nil
+		}
+		opts = []oss.Option{oss.Prefix(res.Prefix), oss.ContinuationToken(res.NextContinuationToken)}
+	}
+}
+func (s *ossStorage) Delete(name string) error {
+	return s.error(s.bkt.DeleteObject(objectKey(s.prefix, name)))
+}
@@ -0,0 +1,323 @@
+package mored
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/zj-sh/mrd/util"
+	"gopkg.in/yaml.v3"
+	"math/rand"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Status tells how a built chart relates to the published index.
+type Status int
+
+const (
+	StatusNew       Status = iota // the version is not published yet
+	StatusPublished               // the version is published with the same archive
+	StatusConflict                // the version is published with a different archive
+)
+
+type Publisher struct {
+	Storage Storage
+	Dist    string
+	Signer  ed25519.PrivateKey
+	// Force replaces published versions whose archive differs, the replacement is recorded in the index history.
+	Force bool
+	Jobs  int
+	// Uploaded is called with the name of every object written, Warnf with recoverable problems, both may be nil.
+	Uploaded func(name string)
+	Warnf    func(format string, a ...any)
+}
+
+func (p *Publisher) uploaded(name string) {
+	if p.Uploaded != nil {
+		p.Uploaded(name)
+	}
+}
+func (p *Publisher) warnf(format string, a ...any) {
+	if p.Warnf != nil {
+		p.Warnf(format, a...)
+	}
+}
+func (p *Publisher) SignerID() string {
+	if p.Signer == nil {
+		return ""
+	}
+	return util.KeyID(p.Signer.Public().(ed25519.PublicKey))
+}
+
+// Put writes the object name, followed by its detached signature when a signing key is set.
+func (p *Publisher) Put(name string, data []byte) error {
+	if err := p.Storage.Put(name, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	p.uploaded(name)
+	return p.putSignature(name, data)
+}
+func (p *Publisher) putSignature(name string, data []byte) error {
+	if p.Signer == nil {
+		return nil
+	}
+	if err := p.Storage.Put(name+DefaultSignatureExt, bytes.NewReader(util.Sign(p.Signer, data))); err != nil {
+		return err
+	}
+	p.uploaded(name + DefaultSignatureExt)
+	return nil
+}
+
+// Upload writes the archive of chart from Dist and records the signer in the chart. Without Force the
+// archive is created only when missing, so a concurrent push of the same version cannot replace it.
+func (p *Publisher) Upload(kind string, chart *Chart) error {
+	name := ChartObject(kind, chart)
+	d, err := os.ReadFile(path.Join(p.Dist, name))
+	if err != nil {
+		return err
+	}
+	if p.Force {
+		err = p.Put(name, d)
+	} else {
+		err = p.create(name, d)
+	}
+	if err != nil {
+		return err
+	}
+	if chart.Metadata == nil {
+		chart.Metadata = &Metadata{}
+	}
+	chart.Metadata.Signer = p.SignerID()
+	return nil
+}
+
+// create writes the new object name, an existing one is accepted when an interrupted push left the same data.
+// A conflict without an object means another writer holds the lock, it is retried like UpdateIndex.
+func (p *Publisher) create(name string, data []byte) error {
+	for i := 1; ; i++ {
+		err := p.Storage.PutIf(name, bytes.NewReader(data), "")
+		if err == nil {
+			p.uploaded(name)
+			return p.putSignature(name, data)
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+		existing, err := ReadObject(p.Storage, name)
+		switch {
+		case errors.Is(err, ErrObjectNotExist) && i < DefaultIndexRetries:
+			time.Sleep(time.Duration(i*100+rand.Intn(200)) * time.Millisecond)
+			continue
+		case errors.Is(err, ErrObjectNotExist):
+			return fmt.Errorf("%s is locked by another push: %w", name, ErrConflict)
+		case err != nil:
+			return err
+		}
+		if !bytes.Equal(existing, data) {
+			return fmt.Errorf("%s %w by another push", name, ErrPublished)
+		}
+		return p.putSignature(name, data)
+	}
+}
+
+// ReadIndex returns the remote index with the ETag it was read at, a corrupted index is replaced when tolerant.
+func (p *Publisher) ReadIndex(tolerant bool) (*Index, string, error) {
+	obj, err := p.Storage.Stat(DefaultIndexFile)
+	if errors.Is(err, ErrObjectNotExist) {
+		p.warnf("remote index does not exist, a new index will be created")
+		return NewIndex(), "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	index, err := LoadIndex(p.Storage)
+	switch {
+	case errors.Is(err, ErrObjectNotExist):
+		return index, obj.ETag, nil
+	case tolerant && errors.Is(err, ErrIndexCorrupted):
+		p.warnf("%s, it will be replaced", err.Error())
+		return NewIndex(), obj.ETag, nil
+	case err != nil:
+		return nil, "", err
+	}
+	return index, obj.ETag, nil
+}
+
+// UpdateIndex applies fc to the latest remote index and writes it back, retrying when another writer won the race.
+func (p *Publisher) UpdateIndex(tolerant bool, fc func(index *Index) error) ([]byte, error) {
+	for i := 1; ; i++ {
+		index, etag, err := p.ReadIndex(tolerant)
+		if err != nil {
+			return nil, err
+		}
+		if err = fc(index); err != nil {
+			return nil, err
+		}
+		index.Digests = index.DigestAlgorithms()
+		d, err := yaml.Marshal(index)
+		if err != nil {
+			return nil, err
+		}
+		err = p.Storage.PutIf(DefaultIndexFile, bytes.NewReader(d), etag)
+		if errors.Is(err, ErrConflict) && i < DefaultIndexRetries {
+			p.warnf("remote index changed concurrently, retrying %d/%d", i, DefaultIndexRetries-1)
+			time.Sleep(time.Duration(i*100+rand.Intn(200)) * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.uploaded(DefaultIndexFile)
+		return d, p.signIndex(d)
+	}
+}
+
+// signIndex writes the signature of the index d conditionally, it is skipped once a newer index replaced d
+// so a late writer never leaves the signature of an old index behind.
+func (p *Publisher) signIndex(d []byte) error {
+	if p.Signer == nil {
+		return nil
+	}
+	name := DefaultIndexFile + DefaultSignatureExt
+	for i := 1; ; i++ {
+		var etag string
+		obj, err := p.Storage.Stat(name)
+		switch {
+		case err == nil:
+			etag = obj.ETag
+		case !errors.Is(err, ErrObjectNotExist):
+			return err
+		}
+		current, err := ReadObject(p.Storage, DefaultIndexFile)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, d) {
+			return nil
+		}
+		err = p.Storage.PutIf(name, bytes.NewReader(util.Sign(p.Signer, d)), etag)
+		if errors.Is(err, ErrConflict) && i < DefaultIndexRetries {
+			time.Sleep(time.Duration(i*100+rand.Intn(200)) * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		p.uploaded(name)
+		return nil
+	}
+}
+
+// Status compares local with the same version in index, the published chart is returned when there is one.
+func (p *Publisher) Status(index *Index, kind string, local *Chart) (Status, *Chart) {
+	published := index.Find(kind, local.Name, local.Version)
+	switch {
+	case published == nil:
+		return StatusNew, nil
+	case p.sameArchive(kind, local, published):
+		return StatusPublished, published
+	}
+	return StatusConflict, published
+}
+
+// sameArchive compares the built archive of local with the published digest, which may use another algorithm.
+func (p *Publisher) sameArchive(kind string, local, published *Chart) bool {
+	if ChartDigest(local) == ChartDigest(published) {
+		return true
+	}
+	return util.VerifyDigest(path.Join(p.Dist, ChartObject(kind, local)), ChartDigest(published)) == nil
+}
+func Published(kind string, chart *Chart) error {
+	return fmt.Errorf("%s %s@%s %w with digest %s", kind, chart.Name, chart.Version, ErrPublished, ChartDigest(chart))
+}
+
+// Merge adds charts to index, a published version is only replaced by a different archive with Force.
+func (p *Publisher) Merge(index *Index, kind string, charts map[string][]*Chart, author *Author) error {
+	all := index.Charts(kind)
+	for name, cts := range charts {
+		for _, l := range cts {
+			status, published := p.Status(index, kind, l)
+			if status == StatusNew {
+				all[name] = append(all[name], l)
+				continue
+			}
+			if status == StatusConflict {
+				if !p.Force {
+					return Published(kind, published)
+				}
+				index.History = append(index.History, &Replacement{
+					Kind:     kind,
+					Name:     l.Name,
+					Version:  l.Version,
+					From:     ChartDigest(published),
+					To:       ChartDigest(l),
+					Author:   author.Name,
+					Replaced: author.Generated,
+				})
+			}
+			l.Yanked, l.Deprecated = published.Yanked, published.Deprecated
+			all[name][slices.Index(all[name], published)] = l
+		}
+		SortCharts(all[name])
+	}
+	return nil
+}
+
+// Publish uploads the charts of kind that are not published yet and merges them into the remote index,
+// it returns the uploaded charts and the written index. Nothing is uploaded when a version is published
+// with a different archive and Force is not set, the error joins every such version.
+func (p *Publisher) Publish(kind string, charts map[string][]*Chart, author *Author) ([]*Chart, []byte, error) {
+	index, _, err := p.ReadIndex(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var items []*Chart
+	var conflicts error
+	pending := make(map[string][]*Chart)
+	for name, cts := range charts {
+		for _, l := range cts {
+			status, published := p.Status(index, kind, l)
+			switch {
+			case status == StatusPublished:
+				continue
+			case status == StatusConflict && !p.Force:
+				conflicts = errors.Join(conflicts, Published(kind, published))
+				continue
+			case status == StatusConflict:
+				p.warnf("overwriting %s %s@%s, published digest %s", kind, name, l.Version, ChartDigest(published))
+			}
+			items = append(items, l)
+			pending[name] = append(pending[name], l)
+		}
+	}
+	if conflicts != nil {
+		return nil, nil, conflicts
+	}
+	if len(items) == 0 {
+		return nil, nil, nil
+	}
+	var mu sync.Mutex
+	var failed error
+	util.Parallel(max(p.Jobs, 1), items, func(chart *Chart) {
+		if err := p.Upload(kind, chart); err != nil {
+			mu.Lock()
+			failed = errors.Join(failed, fmt.Errorf("%s@%s: %w", chart.Name, chart.Version, err))
+			mu.Unlock()
+		}
+	})
+	if failed != nil {
+		return nil, nil, failed
+	}
+	d, err := p.UpdateIndex(false, func(index *Index) error {
+		index.MergeAuthor(author)
+		return p.Merge(index, kind, pending, author)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, d, nil
+}
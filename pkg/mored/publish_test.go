@@ -0,0 +1,222 @@
+package mored
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/zj-sh/mrd/util"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// buildKit builds a kit archive of name@version with content into dist.
+func buildKit(t *testing.T, dist, name, version, content string) *Chart {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, DefaultKitMainFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chart := &Chart{Name: name, Version: version}
+	if _, err := BuildArchive(DefaultKitDist, src, dist, nil, chart, util.DigestSHA256); err != nil {
+		t.Fatal(err)
+	}
+	return chart
+}
+
+func TestPublishConcurrent(t *testing.T) {
+	st, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pushers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, pushers)
+	for i := 0; i < pushers; i++ {
+		dist := t.TempDir()
+		chart := buildKit(t, dist, fmt.Sprintf("k%d", i), "1.0.0", fmt.Sprintf("echo %d", i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := &Publisher{Storage: st, Dist: dist, Jobs: 2}
+			_, _, errs[i] = p.Publish(DefaultKitDist, map[string][]*Chart{chart.Name: {chart}}, NewAuthor())
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("pusher %d: %v", i, err)
+		}
+	}
+	index, err := LoadIndex(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < pushers; i++ {
+		name := fmt.Sprintf("k%d", i)
+		if index.Find(DefaultKitDist, name, "1.0.0") == nil {
+			t.Errorf("%s is missing from the index", name)
+		}
+	}
+}
+
+// conflictStorage fails the first conditional write of name like a concurrent writer would.
+type conflictStorage struct {
+	Storage
+	name      string
+	mu        sync.Mutex
+	conflicts int
+}
+
+func (s *conflictStorage) PutIf(name string, r io.Reader, etag string) error {
+	s.mu.Lock()
+	conflict := name == s.name && s.conflicts == 0
+	if conflict {
+		s.conflicts++
+	}
+	s.mu.Unlock()
+	if conflict {
+		return ErrConflict
+	}
+	return s.Storage.PutIf(name, r, etag)
+}
+
+func TestPublishRetriesConflict(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &conflictStorage{Storage: local, name: DefaultIndexFile}
+	dist := t.TempDir()
+	chart := buildKit(t, dist, "k1", "1.0.0", "echo")
+	p := &Publisher{Storage: st, Dist: dist}
+	if _, _, err = p.Publish(DefaultKitDist, map[string][]*Chart{"k1": {chart}}, NewAuthor()); err != nil {
+		t.Fatal(err)
+	}
+	if st.conflicts != 1 {
+		t.Fatalf("expected one conflict, got %d", st.conflicts)
+	}
+	index, err := LoadIndex(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Find(DefaultKitDist, "k1", "1.0.0") == nil {
+		t.Fatal("k1 is missing from the index after the retry")
+	}
+}
+
+func TestPublishLockedArchive(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dist := t.TempDir()
+	chart := buildKit(t, dist, "k1", "1.0.0", "echo")
+	// the archive is not written yet, the conflict comes from a lock held by another writer
+	st := &conflictStorage{Storage: local, name: ChartObject(DefaultKitDist, chart)}
+	if err = (&Publisher{Storage: st, Dist: dist}).Upload(DefaultKitDist, chart); err != nil {
+		t.Fatalf("upload while the archive was locked: %v", err)
+	}
+	if st.conflicts != 1 {
+		t.Fatalf("expected one conflict, got %d", st.conflicts)
+	}
+	if _, err = local.Stat(st.name); err != nil {
+		t.Fatalf("archive was not written after the retry: %v", err)
+	}
+}
+
+func TestPublishSameVersion(t *testing.T) {
+	st, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	winner, loser := t.TempDir(), t.TempDir()
+	chart := buildKit(t, winner, "k1", "1.0.0", "echo winner")
+	late := buildKit(t, loser, "k1", "1.0.0", "echo loser")
+	if _, _, err = (&Publisher{Storage: st, Dist: winner}).Publish(DefaultKitDist, map[string][]*Chart{"k1": {chart}}, NewAuthor()); err != nil {
+		t.Fatal(err)
+	}
+	// the loser read the index before the winner merged it, so it still uploads
+	if err = (&Publisher{Storage: st, Dist: loser}).Upload(DefaultKitDist, late); !errors.Is(err, ErrPublished) {
+		t.Fatalf("upload over a published archive: %v", err)
+	}
+	index, err := LoadIndex(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := index.Find(DefaultKitDist, "k1", "1.0.0")
+	archive := filepath.Join(t.TempDir(), "k1.tar.gz")
+	if err = Download(st, ChartObject(DefaultKitDist, published), archive); err != nil {
+		t.Fatal(err)
+	}
+	if err = util.VerifyDigest(archive, ChartDigest(published)); err != nil {
+		t.Fatalf("stored archive does not match the index: %v", err)
+	}
+}
+
+func TestPublishInterrupted(t *testing.T) {
+	st, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dist := t.TempDir()
+	chart := buildKit(t, dist, "k1", "1.0.0", "echo")
+	p := &Publisher{Storage: st, Dist: dist}
+	// an earlier push uploaded the archive but never merged the index
+	if err = p.Upload(DefaultKitDist, chart); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = p.Publish(DefaultKitDist, map[string][]*Chart{"k1": {chart}}, NewAuthor()); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := LoadIndex(st); index.Find(DefaultKitDist, "k1", "1.0.0") == nil {
+		t.Fatal("k1 is missing from the index")
+	}
+}
+
+func TestPublishSignsLatestIndex(t *testing.T) {
+	st, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		dist := t.TempDir()
+		chart := buildKit(t, dist, fmt.Sprintf("k%d", i), "1.0.0", fmt.Sprintf("echo %d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := &Publisher{Storage: st, Dist: dist, Signer: priv}
+			if _, _, err := p.Publish(DefaultKitDist, map[string][]*Chart{chart.Name: {chart}}, NewAuthor()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	verify := func() {
+		t.Helper()
+		index, err := ReadObject(st, DefaultIndexFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ReadObject(st, DefaultIndexFile+DefaultSignatureExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = util.VerifySignature(map[string]ed25519.PublicKey{util.KeyID(pub): pub}, index, sig); err != nil {
+			t.Fatalf("index signature does not match the index: %v", err)
+		}
+	}
+	verify()
+	// a writer that lost the race signs its index after the index was replaced
+	if err = (&Publisher{Storage: st, Signer: priv}).signIndex([]byte("kits: {}\n")); err != nil {
+		t.Fatal(err)
+	}
+	verify()
+}
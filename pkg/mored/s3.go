@@ -0,0 +1,135 @@
+package mored
+
+import (
+	"bytes"
+	"context"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const DefaultS3PartSize = 16 << 20
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Key       string
+	Secret    string
+	Bucket    string
+	Prefix    string
+	PathStyle bool
+}
+
+// NewS3Storage opens a repository stored under Prefix of a s3 compatible bucket, an http:// endpoint is plain.
+func NewS3Storage(conf S3Config) (Storage, error) {
+	host, secure := S3Endpoint(conf.Endpoint)
+	lookup := minio.BucketLookupAuto
+	if conf.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	clt, err := minio.New(host, &minio.Options{
+		Creds:        credentials.NewStaticV4(conf.Key, conf.Secret, ""),
+		Secure:       secure,
+		Region:       conf.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Storage{clt: clt, bucket: conf.Bucket, prefix: conf.Prefix}, nil
+}
+
+// S3Endpoint strips the scheme from endpoint, plain hosts are served over https.
+func S3Endpoint(endpoint string) (string, bool) {
+	if strings.HasPrefix(endpoint, "http://") {
+		return strings.TrimPrefix(endpoint, "http://"), false
+	}
+	return strings.TrimPrefix(endpoint, "https://"), true
+}
+
+type s3Storage struct {
+	clt    *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Storage) error(err error) error {
+	if err != nil && minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return ErrObjectNotExist
+	}
+	return err
+}
+func (s *s3Storage) Get(name string) (io.ReadCloser, error) {
+	obj, err := s.clt.GetObject(context.Background(), s.bucket, objectKey(s.prefix, name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.error(err)
+	}
+	if _, err = obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, s.error(err)
+	}
+	return obj, nil
+}
+
+// Put sends sized readers in one request, others are uploaded in parts that minio buffers in memory.
+func (s *s3Storage) Put(name string, r io.Reader) error {
+	size := int64(-1)
+	if l, ok := r.(interface{ Len() int }); ok {
+		size = int64(l.Len())
+	}
+	_, err := s.clt.PutObject(context.Background(), s.bucket, objectKey(s.prefix, name), r, size, minio.PutObjectOptions{PartSize: DefaultS3PartSize})
+	return err
+}
+func (s *s3Storage) PutIf(name string, r io.Reader, etag string) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{}
+	if etag != "" {
+		opts.SetMatchETag(strings.Trim(etag, `"`))
+	} else {
+		opts.SetMatchETagExcept("*")
+	}
+	_, err = s.clt.PutObject(context.Background(), s.bucket, objectKey(s.prefix, name), bytes.NewReader(d), int64(len(d)), opts)
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return ErrConflict
+	case http.StatusNotFound:
+		if etag != "" {
+			return ErrConflict
+		}
+	}
+	return err
+}
+func (s *s3Storage) Stat(name string) (*Object, error) {
+	info, err := s.clt.StatObject(context.Background(), s.bucket, objectKey(s.prefix, name), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.error(err)
+	}
+	return &Object{Name: name, Size: info.Size, ETag: info.ETag, Modified: info.LastModified}, nil
+}
+func (s *s3Storage) List(prefix string) ([]*Object, error) {
+	var objs []*Object
+	root := objectKey(s.prefix, "") + "/"
+	for info := range s.clt.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    objectKey(s.prefix, prefix),
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, s.error(info.Err)
+		}
+		objs = append(objs, &Object{
+			Name:     strings.TrimPrefix(info.Key, root),
+			Size:     info.Size,
+			ETag:     info.ETag,
+			Modified: info.LastModified,
+		})
+	}
+	return objs, nil
+}
+func (s *s3Storage) Delete(name string) error {
+	return s.error(s.clt.RemoveObject(context.Background(), s.bucket, objectKey(s.prefix, name), minio.RemoveObjectOptions{}))
+}
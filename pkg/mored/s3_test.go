@@ -0,0 +1,231 @@
+package mored
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-process s3 server with path style buckets, single part uploads and conditional writes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, prefix string) Storage {
+	t.Helper()
+	srv := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	t.Cleanup(srv.Close)
+	st, err := NewS3Storage(S3Config{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		Key:       "key",
+		Secret:    "secret",
+		Bucket:    "mored",
+		Prefix:    prefix,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	d, exists := f.objects[key]
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		body, err := readBody(r)
+		if err != nil {
+			f.error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		match, noneMatch := r.Header.Get("If-Match"), strings.Trim(r.Header.Get("If-None-Match"), `"`)
+		if (match != "" && (!exists || etag(d) != match)) || (noneMatch == "*" && exists) {
+			f.error(w, r, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		f.objects[key] = body
+		w.Header().Set("ETag", etag(body))
+	case !exists && r.Method != http.MethodDelete:
+		f.error(w, r, http.StatusNotFound, "NoSuchKey")
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		w.Header().Set("ETag", etag(d))
+		w.Header().Set("Content-Length", strconv.Itoa(len(d)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(d)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	res := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: "mored", Prefix: prefix, MaxKeys: 1000}
+	for key, d := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			res.Contents = append(res.Contents, content{Key: key, LastModified: time.Now().UTC().Format(time.RFC3339), ETag: etag(d), Size: len(d)})
+		}
+	}
+	res.KeyCount = len(res.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(res)
+}
+func (f *fakeS3) error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource></Error>`, code, code, r.URL.Path)
+	}
+}
+func etag(d []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(d))
+}
+
+// readBody decodes the aws-chunked bodies minio signs over plain http.
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var out bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return out.Bytes(), nil
+		}
+		if _, err = io.CopyN(&out, br, n); err != nil {
+			return nil, err
+		}
+		if _, err = br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	st := newFakeS3(t, "repo")
+	if _, err := st.Get("missing"); !errors.Is(err, ErrObjectNotExist) {
+		t.Fatalf("get of a missing object: %v", err)
+	}
+	if _, err := st.Stat("missing"); !errors.Is(err, ErrObjectNotExist) {
+		t.Fatalf("stat of a missing object: %v", err)
+	}
+	if err := st.Put("kit/a.tar.gz", strings.NewReader("archive")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadObject(st, "kit/a.tar.gz")
+	if err != nil || string(d) != "archive" {
+		t.Fatalf("read back %q: %v", d, err)
+	}
+	if err = st.Put("suite/b.tar.gz", strings.NewReader("suite")); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := st.List("kit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].Name != "kit/a.tar.gz" || objs[0].Size != 7 {
+		t.Fatalf("unexpected listing %+v", objs)
+	}
+	if err = st.Delete("kit/a.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.Stat("kit/a.tar.gz"); !errors.Is(err, ErrObjectNotExist) {
+		t.Fatalf("stat after delete: %v", err)
+	}
+}
+
+func TestS3PutIf(t *testing.T) {
+	st := newFakeS3(t, "")
+	if err := st.PutIf(DefaultIndexFile, strings.NewReader("one"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.PutIf(DefaultIndexFile, strings.NewReader("two"), ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("create over an existing object: %v", err)
+	}
+	obj, err := st.Stat(DefaultIndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutIf(DefaultIndexFile, strings.NewReader("two"), obj.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutIf(DefaultIndexFile, strings.NewReader("six"), obj.ETag); !errors.Is(err, ErrConflict) {
+		t.Fatalf("write with a stale etag: %v", err)
+	}
+	if err = st.PutIf("missing", strings.NewReader("x"), obj.ETag); !errors.Is(err, ErrConflict) {
+		t.Fatalf("write with an etag of a missing object: %v", err)
+	}
+}
+
+func TestS3PublishConcurrent(t *testing.T) {
+	st := newFakeS3(t, "repo")
+	var wg sync.WaitGroup
+	var names []string
+	for i := 0; i < 4; i++ {
+		dist := t.TempDir()
+		chart := buildKit(t, dist, fmt.Sprintf("k%d", i), "1.0.0", fmt.Sprintf("echo %d", i))
+		names = append(names, chart.Name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := &Publisher{Storage: st, Dist: dist}
+			if _, _, err := p.Publish(DefaultKitDist, map[string][]*Chart{chart.Name: {chart}}, NewAuthor()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	index, err := LoadIndex(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(index.Kits[name], func(ct *Chart) bool { return ct.Version == "1.0.0" }) {
+			t.Errorf("%s is missing from the index", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package mored
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultIndexRetries = 10
+	DefaultLockExpiry   = 30 * time.Second
+	DefaultSignatureExt = ".sig"
+)
+
+var (
+	ErrObjectNotExist = errors.New("object does not exist")
+	ErrConflict       = errors.New("object was modified concurrently")
+	ErrIndexCorrupted = errors.New("index is corrupted")
+	ErrPublished      = errors.New("is already published")
+)
+
+type Object struct {
+	Name     string
+	Size     int64
+	ETag     string
+	Modified time.Time
+}
+
+// Storage is a repository backend, object names are relative to the repository prefix.
+type Storage interface {
+	Get(name string) (io.ReadCloser, error)
+	Put(name string, r io.Reader) error
+	// PutIf writes only when the current ETag equals etag, an empty etag means the object must not exist.
+	PutIf(name string, r io.Reader, etag string) error
+	Stat(name string) (*Object, error)
+	List(prefix string) ([]*Object, error)
+	Delete(name string) error
+}
+
+func ReadObject(st Storage, name string) ([]byte, error) {
+	r, err := st.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+func Download(st Storage, name, filename string) error {
+	r, err := st.Get(name)
+	if err != nil {
+		return fmt.Errorf("download %s failed: %w", name, err)
+	}
+	defer r.Close()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// CheckETag is the compare half of PutIf for drivers without native conditional writes.
+func CheckETag(st Storage, name, etag string) error {
+	obj, err := st.Stat(name)
+	switch {
+	case errors.Is(err, ErrObjectNotExist):
+		if etag != "" {
+			return ErrConflict
+		}
+		return nil
+	case err != nil:
+		return err
+	case obj.ETag != etag:
+		return ErrConflict
+	}
+	return nil
+}
+func objectKey(prefix, name string) string {
+	return strings.TrimPrefix(path.Join(prefix, name), "/")
+}
+func OpenRemote(remote string) (Storage, error) {
+	switch {
+	case strings.HasPrefix(remote, "file://"):
+		return &localStorage{dir: LocalRoot(remote)}, nil
+	case strings.HasPrefix(remote, "http://"), strings.HasPrefix(remote, "https://"):
+		return &httpStorage{base: strings.TrimSuffix(remote, "/"), clt: &http.Client{Timeout: 5 * time.Minute}}, nil
+	}
+	return nil, fmt.Errorf("unsupported remote %s", remote)
+}
+
+var errReadOnly = errors.New("http repository is read-only")
+
+type httpStorage struct {
+	base string
+	clt  *http.Client
+}
+
+func (s *httpStorage) do(method, name string) (*http.Response, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", s.base, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.clt.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden:
+		_ = resp.Body.Close()
+		return nil, ErrObjectNotExist
+	case resp.StatusCode >= http.StatusBadRequest:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+func (s *httpStorage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, name)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+func (s *httpStorage) Put(string, io.Reader) error {
+	return errReadOnly
+}
+func (s *httpStorage) PutIf(string, io.Reader, string) error {
+	return errReadOnly
+}
+func (s *httpStorage) Stat(name string) (*Object, error) {
+	resp, err := s.do(http.MethodHead, name)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{Name: name, Size: resp.ContentLength, ETag: resp.Header.Get("ETag"), Modified: modified}, nil
+}
+func (s *httpStorage) List(string) ([]*Object, error) {
+	return nil, errReadOnly
+}
+func (s *httpStorage) Delete(string) error {
+	return errReadOnly
+}
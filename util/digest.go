@@ -0,0 +1,79 @@
+package util
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	DigestMD5    = "md5"
+	DigestSHA256 = "sha256"
+	DigestSHA512 = "sha512"
+)
+
+var legacyDigest = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestMD5:
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %s", algorithm)
+}
+
+// FileDigest returns the digest of filename as <algorithm>:<hex>, md5 keeps the legacy bare hex.
+func FileDigest(filename, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if algorithm == DigestMD5 {
+		return sum, nil
+	}
+	return fmt.Sprintf("%s:%s", algorithm, sum), nil
+}
+
+// DigestAlgorithm returns the algorithm of a digest, bare 32 hex digits are legacy md5.
+func DigestAlgorithm(digest string) string {
+	if algorithm, _, ok := strings.Cut(digest, ":"); ok {
+		return algorithm
+	}
+	if legacyDigest.MatchString(digest) {
+		return DigestMD5
+	}
+	return ""
+}
+func VerifyDigest(filename, digest string) error {
+	if digest == "" {
+		return fmt.Errorf("missing digest")
+	}
+	actual, err := FileDigest(filename, DigestAlgorithm(digest))
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return fmt.Errorf("digest mismatch, expected %s got %s", digest, actual)
+	}
+	return nil
+}
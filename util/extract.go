@@ -0,0 +1,254 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ExtractLimit struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+var DefaultExtractLimit = ExtractLimit{
+	MaxEntries:   10000,
+	MaxFileSize:  1 << 30,
+	MaxTotalSize: 4 << 30,
+}
+
+func UnCompress(tarFile, dest string) error {
+	return Extract(tarFile, dest, DefaultExtractLimit)
+}
+
+// Extract unpacks a tar.gz archive into dest, every entry and symlink must stay inside dest.
+func Extract(tarFile, dest string, limit ExtractLimit) error {
+	srcFile, err := os.Open(tarFile)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	gr, err := gzip.NewReader(srcFile)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return err
+	}
+	if dest, err = filepath.EvalSymlinks(dest); err != nil {
+		return err
+	}
+	x := &extractor{dest: dest, limit: limit}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = x.entry(tr, hdr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+	return x.finish()
+}
+
+type extractor struct {
+	dest    string
+	limit   ExtractLimit
+	entries int
+	total   int64
+	dirs    []*tar.Header
+	links   []string
+}
+
+func (x *extractor) entry(tr *tar.Reader, hdr *tar.Header) error {
+	x.entries++
+	if x.entries > x.limit.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", x.limit.MaxEntries)
+	}
+	switch {
+	case hdr.Typeflag == tar.TypeXGlobalHeader, hdr.Typeflag == tar.TypeXHeader,
+		hdr.Typeflag == tar.TypeGNULongName, hdr.Typeflag == tar.TypeGNULongLink:
+		// metadata only, e.g. the pax header of git archive
+		return nil
+	case filepath.Clean(filepath.FromSlash(strings.TrimPrefix(hdr.Name, "/"))) == ".":
+		// the destination itself, written by tar -C dir .
+		return nil
+	}
+	target, err := x.target(hdr.Name)
+	if err != nil {
+		return err
+	}
+	if err = x.mkdir(filepath.Dir(target)); err != nil {
+		return err
+	}
+	mode := hdr.FileInfo().Mode().Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err = x.mkdir(target); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, hdr)
+		return os.Chmod(target, mode|0700)
+	case tar.TypeReg:
+		if hdr.Size > x.limit.MaxFileSize {
+			return fmt.Errorf("file is larger than %s", Filesize(x.limit.MaxFileSize))
+		}
+		x.total += hdr.Size
+		if x.total > x.limit.MaxTotalSize {
+			return fmt.Errorf("archive is larger than %s", Filesize(x.limit.MaxTotalSize))
+		}
+		if err = x.replace(target); err != nil {
+			return err
+		}
+		if err = x.write(tr, target, mode, hdr.Size); err != nil {
+			return err
+		}
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	case tar.TypeSymlink:
+		if filepath.IsAbs(hdr.Linkname) {
+			return fmt.Errorf("symlink to absolute path %s", hdr.Linkname)
+		}
+		if !x.inside(filepath.Join(filepath.Dir(target), filepath.FromSlash(hdr.Linkname))) {
+			return fmt.Errorf("symlink %s escapes destination", hdr.Linkname)
+		}
+		if err = x.replace(target); err != nil {
+			return err
+		}
+		if err = os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+		x.links = append(x.links, target)
+		// dangling links are checked by finish once the archive is complete
+		if _, err = os.Stat(target); err == nil {
+			if err = x.resolved(target); err != nil {
+				_ = os.Remove(target)
+				return err
+			}
+		}
+		return nil
+	case tar.TypeLink:
+		source, err := x.target(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if err = x.resolved(source); err != nil {
+			return err
+		}
+		if err = x.replace(target); err != nil {
+			return err
+		}
+		return os.Link(source, target)
+	}
+	return fmt.Errorf("unsupported entry type %q", hdr.Typeflag)
+}
+
+// target maps an entry name into dest. One leading / is stripped like tar does, archives built before
+// reproducible builds name every entry /<path>.
+func (x *extractor) target(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return "", errors.New("absolute path in archive")
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("path traversal in archive")
+	}
+	return filepath.Join(x.dest, clean), nil
+}
+func (x *extractor) inside(name string) bool {
+	return name == x.dest || strings.HasPrefix(name, x.dest+string(filepath.Separator))
+}
+
+// resolved checks the physical location of name after following symlinks created so far.
+func (x *extractor) resolved(name string) error {
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	if !x.inside(real) {
+		return fmt.Errorf("%s resolves outside destination", name)
+	}
+	return nil
+}
+
+// mkdir creates dir after checking its nearest existing parent does not resolve outside dest.
+func (x *extractor) mkdir(dir string) error {
+	parent := dir
+	for {
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	if err := x.resolved(parent); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// replace removes an existing non-directory entry so writes never follow an old symlink.
+func (x *extractor) replace(target string) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", target)
+	}
+	return os.Remove(target)
+}
+func (x *extractor) write(r io.Reader, target string, mode os.FileMode, size int64) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, size))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if n != size {
+		_ = f.Close()
+		return io.ErrUnexpectedEOF
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, mode)
+}
+
+// finish applies directory times after their content is written and rejects symlinks that resolve outside dest.
+func (x *extractor) finish() error {
+	for _, link := range x.links {
+		if _, err := os.Stat(link); err != nil {
+			continue
+		}
+		if err := x.resolved(link); err != nil {
+			return err
+		}
+	}
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		target, _ := x.target(x.dirs[i].Name)
+		if err := os.Chtimes(target, x.dirs[i].ModTime, x.dirs[i].ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
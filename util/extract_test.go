@@ -0,0 +1,161 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func file(name, body string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}, body: body}
+}
+func dir(name string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}}
+}
+func symlink(name, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+func hardlink(name, target string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func writeTar(t *testing.T, filename string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err = tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	small := ExtractLimit{MaxEntries: 3, MaxFileSize: 4, MaxTotalSize: 6}
+	cases := []struct {
+		name    string
+		entries []tarEntry
+		limit   ExtractLimit
+		err     string
+	}{
+		{name: "plain", entries: []tarEntry{dir("bin/"), file("bin/kit.sh", "echo")}},
+		{name: "dot root", entries: []tarEntry{dir("./"), file("./bin/kit.sh", "echo")}},
+		{name: "pax global header", entries: []tarEntry{
+			{hdr: tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123abcd"}}},
+			file("bin/kit.sh", "echo"),
+		}},
+		{name: "symlink inside", entries: []tarEntry{file("bin/kit.sh", "echo"), symlink("kit.sh", "bin/kit.sh")}},
+		{name: "parent traversal", entries: []tarEntry{file("../evil", "x")}, err: "path traversal"},
+		{name: "nested traversal", entries: []tarEntry{file("bin/../../evil", "x")}, err: "path traversal"},
+		{name: "legacy leading slash", entries: []tarEntry{dir("/bin"), file("/bin/kit.sh", "echo"), symlink("/kit.sh", "bin/kit.sh")}},
+		{name: "legacy traversal", entries: []tarEntry{file("/../evil", "x")}, err: "path traversal"},
+		{name: "absolute name", entries: []tarEntry{file("//tmp/evil", "x")}, err: "absolute path"},
+		{name: "symlink outside", entries: []tarEntry{symlink("l", "../..")}, err: "escapes destination"},
+		{name: "absolute symlink", entries: []tarEntry{symlink("l", "/etc")}, err: "absolute path"},
+		{name: "symlink chain escape", entries: []tarEntry{
+			symlink("s", "."),
+			symlink("e", "s/s/../.."),
+		}, err: "resolves outside"},
+		{name: "write through symlinked parent", entries: []tarEntry{
+			symlink("e", "s/s/../.."),
+			symlink("s", "."),
+			file("e/evil", "x"),
+		}, err: "resolves outside"},
+		{name: "dangling symlink escape", entries: []tarEntry{
+			symlink("e", "s/s/../.."),
+			symlink("s", "."),
+		}, err: "resolves outside"},
+		{name: "hardlink outside", entries: []tarEntry{hardlink("h", "../secret")}, err: "path traversal"},
+		{name: "hardlink absolute", entries: []tarEntry{hardlink("h", "//etc/passwd")}, err: "absolute path"},
+		{name: "hardlink legacy", entries: []tarEntry{file("/bin/kit.sh", "echo"), hardlink("/kit.sh", "/bin/kit.sh")}},
+		{name: "hardlink through symlink", entries: []tarEntry{
+			symlink("e", "s/s/../.."),
+			symlink("s", "."),
+			hardlink("h", "e/secret"),
+		}, err: "resolves outside"},
+		{name: "too many entries", limit: small, entries: []tarEntry{
+			file("a", "1"), file("b", "1"), file("c", "1"), file("d", "1"),
+		}, err: "more than 3 entries"},
+		{name: "file too large", limit: small, entries: []tarEntry{file("a", "12345")}, err: "file is larger"},
+		{name: "archive too large", limit: small, entries: []tarEntry{
+			file("a", "1234"), file("b", "1234"),
+		}, err: "archive is larger"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// dest is two levels deep so escapes land inside base and can be detected
+			base := t.TempDir()
+			dest := filepath.Join(base, "a", "b")
+			if err := os.WriteFile(filepath.Join(base, "secret"), []byte("secret"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			archive := filepath.Join(base, "x.tar.gz")
+			writeTar(t, archive, c.entries)
+			limit := c.limit
+			if limit.MaxEntries == 0 {
+				limit = DefaultExtractLimit
+			}
+			err := Extract(archive, dest, limit)
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err != "" && err == nil:
+				t.Fatalf("expected error containing %q", c.err)
+			case c.err != "" && !strings.Contains(err.Error(), c.err):
+				t.Fatalf("expected error containing %q, got %v", c.err, err)
+			}
+			if c.err == "" {
+				if d, err := os.ReadFile(filepath.Join(dest, "bin", "kit.sh")); err != nil || string(d) != "echo" {
+					t.Fatalf("kit.sh was not extracted: %v", err)
+				}
+			}
+			escaped(t, base, dest)
+		})
+	}
+}
+
+// escaped fails when extraction wrote anything outside dest.
+func escaped(t *testing.T, base, dest string) {
+	t.Helper()
+	err := filepath.WalkDir(base, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case name == dest:
+			return filepath.SkipDir
+		case name == base, d.IsDir(), d.Name() == "secret", d.Name() == "x.tar.gz":
+			return nil
+		}
+		t.Errorf("%s was written outside the destination", name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,14 +3,18 @@ package util
 import (
 	"archive/tar"
 	"compress/gzip"
-	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func IsExisted(path string) bool {
@@ -29,109 +33,180 @@ func HasPatternFile(path string, pattern string) bool {
 	}
 	return false
 }
-func Compress(src, dest string, exclude ...string) error {
-	d, _ := os.Create(dest)
+
+// Compress writes a reproducible tar.gz of src: entries are sorted, owners dropped and
+// times fixed to SOURCE_DATE_EPOCH (or the unix epoch) so equal sources give equal digests.
+// It returns the paths left out by ignore.
+func Compress(src, dest string, ignore *Ignore) ([]string, error) {
+	entries, excluded, err := archiveEntries(src, ignore)
+	if err != nil {
+		return excluded, err
+	}
+	return excluded, writeArchive(src, dest, entries)
+}
+func writeArchive(src, dest string, entries []string) error {
+	d, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
 	defer d.Close()
 	gw := gzip.NewWriter(d)
-	defer gw.Close()
 	tw := tar.NewWriter(gw)
-	defer tw.Close()
-	return filepath.Walk(src, func(filename string, fi os.FileInfo, err error) error {
-		if !fi.IsDir() {
-			for _, ex := range exclude {
-				if ok, _ := regexp.MatchString(ex, fi.Name()); ok {
-					return nil
-				}
-			}
-			fmt.Println(fmt.Sprintf("=> %s %s", Filesize(fi.Size()), filename))
-			file, err := os.Open(filename)
-			if err != nil {
-				return err
-			}
-			if err = compress(file, "", tw); err != nil {
-				return err
-			}
+	mtime := SourceDateEpoch()
+	for _, rel := range entries {
+		if err = compress(tw, src, rel, mtime); err != nil {
+			return err
 		}
-		return nil
-	})
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	return d.Close()
 }
-func compress(file *os.File, prefix string, tw *tar.Writer) error {
-	info, err := file.Stat()
+
+// SourceDateEpoch honors https://reproducible-builds.org/specs/source-date-epoch/.
+func SourceDateEpoch() time.Time {
+	if sec, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC()
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// SourceDigest hashes what Compress would archive from src, it changes whenever the archive would.
+func SourceDigest(src string, ignore *Ignore) (string, error) {
+	entries, _, err := archiveEntries(src, ignore)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if info.IsDir() {
-		prefix = prefix + "/" + info.Name()
-		fileInfos, err := file.Readdir(-1)
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%d\x00", SourceDateEpoch().Unix())
+	for _, rel := range entries {
+		filename := filepath.Join(src, filepath.FromSlash(rel))
+		fi, err := os.Lstat(filename)
 		if err != nil {
-			return err
+			return "", err
 		}
-		for _, fi := range fileInfos {
-			f, err := os.Open(file.Name() + "/" + fi.Name())
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00%t\x00", rel, fi.Mode().Type(), fi.Mode()&0111 != 0)
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(filename)
 			if err != nil {
-				return err
+				return "", err
 			}
-			err = compress(f, prefix, tw)
-			if err != nil {
-				return err
+			_, _ = io.WriteString(h, link)
+		case fi.Mode().IsRegular():
+			if err = copyFile(h, filename); err != nil {
+				return "", err
 			}
 		}
-	} else {
-		header, err := tar.FileInfoHeader(info, "")
-		header.Name = prefix + "/" + header.Name
+		_, _ = h.Write([]byte{0})
+	}
+	return DigestSHA256 + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+func copyFile(w io.Writer, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+func archiveEntries(src string, ignore *Ignore) ([]string, []string, error) {
+	var entries, excluded []string
+	err := filepath.Walk(src, func(filename string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		err = tw.WriteHeader(header)
+		if filename == src {
+			return nil
+		}
+		rel, err := filepath.Rel(src, filename)
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(tw, file)
-		file.Close()
-		if err != nil {
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, fi.IsDir()) {
+			if fi.IsDir() {
+				excluded = append(excluded, rel+"/")
+				return filepath.SkipDir
+			}
+			excluded = append(excluded, rel)
+			return nil
+		}
+		entries = append(entries, rel)
+		return nil
+	})
+	sort.Strings(entries)
+	sort.Strings(excluded)
+	return entries, excluded, err
+}
+func compress(tw *tar.Writer, src, rel string, mtime time.Time) error {
+	filename := filepath.Join(src, filepath.FromSlash(rel))
+	fi, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(filename); err != nil {
 			return err
 		}
 	}
-	return nil
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	header.ModTime, header.AccessTime, header.ChangeTime = mtime, time.Time{}, time.Time{}
+	header.Mode = 0644
+	if fi.IsDir() || fi.Mode()&0111 != 0 {
+		header.Mode = 0755
+	}
+	header.Format = tar.FormatPAX
+	if fi.IsDir() {
+		header.Name += "/"
+		return tw.WriteHeader(header)
+	}
+	if err = tw.WriteHeader(header); err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
 }
-
-func UnCompress(tarFile, dest string) error {
+func ReadArchiveFile(tarFile, name string) ([]byte, error) {
 	srcFile, err := os.Open(tarFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer srcFile.Close()
 	gr, err := gzip.NewReader(srcFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer gr.Close()
 	tr := tar.NewReader(gr)
 	for {
 		hdr, err := tr.Next()
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return err
-			}
+		if err == io.EOF {
+			return nil, os.ErrNotExist
 		}
-		filename := dest + hdr.Name
-		file, err := createFile(filename)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Clean(strings.TrimPrefix(hdr.Name, "/")) == name {
+			return io.ReadAll(tr)
 		}
-		_, _ = io.Copy(file, tr)
-	}
-	return nil
-}
-
-func createFile(name string) (*os.File, error) {
-	err := os.MkdirAll(string([]rune(name)[0:strings.LastIndex(name, "/")]), 0755)
-	if err != nil {
-		return nil, err
 	}
-	return os.Create(name)
 }
 
 func Filesize(size int64) string {
@@ -159,14 +234,3 @@ func WriteFile(filename string, data []byte) error {
 	}
 	return os.WriteFile(filename, data, os.ModePerm)
 }
-
-func FileDigest(filename string) string {
-	f, err := os.Open(filename)
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-	md5h := md5.New()
-	_, _ = io.Copy(md5h, f)
-	return hex.EncodeToString(md5h.Sum(nil))
-}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testTree = []struct {
+	name string
+	body string
+	mode os.FileMode
+}{
+	{"kit.sh", "#!/bin/sh\necho kit\n", 0755},
+	{"conf/a.yaml", "a: 1\n", 0644},
+	{"conf/b.yaml", "b: 2\n", 0600},
+	{"lib/z/deep.txt", "deep\n", 0644},
+}
+
+// makeTree writes testTree into a new directory in the given order with every mtime set to modified.
+func makeTree(t *testing.T, order []int, modified time.Time) string {
+	t.Helper()
+	src := t.TempDir()
+	for _, i := range order {
+		filename := filepath.Join(src, filepath.FromSlash(testTree[i].name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(testTree[i].body), testTree[i].mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("kit.sh", filepath.Join(src, "run.sh")); err != nil {
+		t.Fatal(err)
+	}
+	err := filepath.Walk(src, func(filename string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(filename, modified, modified)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+// archiveDigest compresses src and returns the digest of the archive.
+func archiveDigest(t *testing.T, src string) string {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "x.tar.gz")
+	if _, err := Compress(src, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, err := FileDigest(dest, DigestSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCompressReproducible(t *testing.T) {
+	order := []int{0, 1, 2, 3}
+	reversed := slices.Clone(order)
+	slices.Reverse(reversed)
+	a := makeTree(t, order, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	b := makeTree(t, reversed, time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC))
+
+	if da, db := archiveDigest(t, a), archiveDigest(t, b); da != db {
+		t.Fatalf("archives differ: %s != %s", da, db)
+	}
+	sa, err := SourceDigest(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb, _ := SourceDigest(b, nil); sa != sb {
+		t.Fatalf("source digests differ: %s != %s", sa, sb)
+	}
+
+	plain := archiveDigest(t, a)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	da, db := archiveDigest(t, a), archiveDigest(t, b)
+	if da != db {
+		t.Fatalf("archives differ under SOURCE_DATE_EPOCH: %s != %s", da, db)
+	}
+	if da == plain {
+		t.Fatal("SOURCE_DATE_EPOCH is not applied to the archive")
+	}
+}
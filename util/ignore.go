@@ -0,0 +1,112 @@
+package util
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// Ignore matches paths against gitignore style patterns, the last matching pattern wins.
+type Ignore struct {
+	rules []*ignoreRule
+}
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func ParseIgnore(patterns ...string) *Ignore {
+	ig := &Ignore{}
+	for _, p := range patterns {
+		p = strings.TrimRight(p, " \t\r")
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		rule := &ignoreRule{}
+		if strings.HasPrefix(p, "!") {
+			rule.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			rule.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		rule.anchored = strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			continue
+		}
+		rule.segments = strings.Split(p, "/")
+		ig.rules = append(ig.rules, rule)
+	}
+	return ig
+}
+
+// LoadIgnore reads the patterns of filename, a missing file yields only the extra patterns.
+func LoadIgnore(filename string, extra ...string) (*Ignore, error) {
+	var patterns []string
+	f, err := os.Open(filename)
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			patterns = append(patterns, scanner.Text())
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return ParseIgnore(append(patterns, extra...)...), nil
+}
+func (ig *Ignore) Match(rel string, dir bool) bool {
+	if ig == nil {
+		return false
+	}
+	ignored := false
+	names := strings.Split(strings.Trim(rel, "/"), "/")
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		var ok bool
+		if rule.anchored {
+			ok = matchSegments(rule.segments, names)
+		} else {
+			ok = matchSegments(rule.segments, names[len(names)-1:])
+		}
+		if ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+func matchSegments(patterns, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		if len(patterns) == 1 {
+			return len(names) > 0
+		}
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patterns[0], names[0]); !ok {
+		return false
+	}
+	return matchSegments(patterns[1:], names[1:])
+}
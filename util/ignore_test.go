@@ -0,0 +1,103 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		path     string
+		dir      bool
+		want     bool
+	}{
+		{name: "basename", patterns: []string{"*.log"}, path: "a.log", want: true},
+		{name: "basename nested", patterns: []string{"*.log"}, path: "sub/dir/a.log", want: true},
+		{name: "basename miss", patterns: []string{"*.log"}, path: "a.txt"},
+		{name: "anchored", patterns: []string{"/build"}, path: "build", dir: true, want: true},
+		{name: "anchored nested", patterns: []string{"/build"}, path: "sub/build", dir: true},
+		{name: "anchored by inner slash", patterns: []string{"doc/api"}, path: "doc/api", want: true},
+		{name: "inner slash nested", patterns: []string{"doc/api"}, path: "sub/doc/api"},
+		{name: "dir only", patterns: []string{"tmp/"}, path: "tmp", dir: true, want: true},
+		{name: "dir only file", patterns: []string{"tmp/"}, path: "tmp"},
+		{name: "dir only nested", patterns: []string{"tmp/"}, path: "sub/tmp", dir: true, want: true},
+		{name: "leading double star", patterns: []string{"**/cache"}, path: "cache", dir: true, want: true},
+		{name: "leading double star nested", patterns: []string{"**/cache"}, path: "a/b/cache", dir: true, want: true},
+		{name: "inner double star", patterns: []string{"a/**/z"}, path: "a/z", want: true},
+		{name: "inner double star deep", patterns: []string{"a/**/z"}, path: "a/b/c/z", want: true},
+		{name: "inner double star unanchored", patterns: []string{"a/**/z"}, path: "x/a/z"},
+		{name: "trailing double star", patterns: []string{"logs/**"}, path: "logs/a/b.log", want: true},
+		{name: "trailing double star dir", patterns: []string{"logs/**"}, path: "logs", dir: true},
+		{name: "negation", patterns: []string{"*.md", "!README.md"}, path: "README.md"},
+		{name: "negation other", patterns: []string{"*.md", "!README.md"}, path: "CHANGES.md", want: true},
+		{name: "last match wins", patterns: []string{"!keep.txt", "*.txt"}, path: "keep.txt", want: true},
+		{name: "comment", patterns: []string{"#x"}, path: "#x"},
+		{name: "escaped hash", patterns: []string{`\#x`}, path: "#x", want: true},
+		{name: "escaped bang", patterns: []string{`\!x`}, path: "!x", want: true},
+		{name: "trailing spaces", patterns: []string{"a.txt  "}, path: "a.txt", want: true},
+		{name: "forced chart file", patterns: []string{"*", "!/Mored.yaml"}, path: "Mored.yaml"},
+		{name: "forced chart file nested", patterns: []string{"*", "!/Mored.yaml"}, path: "sub/Mored.yaml", want: true},
+		{name: "forced chart file others", patterns: []string{"*", "!/Mored.yaml"}, path: "kit.sh", want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ParseIgnore(c.patterns...).Match(c.path, c.dir); got != c.want {
+				t.Fatalf("%q against %q: got %v, want %v", c.path, c.patterns, got, c.want)
+			}
+		})
+	}
+	var ig *Ignore
+	if ig.Match("a", false) {
+		t.Fatal("a nil ignore matched")
+	}
+}
+
+func TestLoadIgnore(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, ".mredignore")
+	ig, err := LoadIgnore(filename, "*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ig.Match("a.log", false) {
+		t.Fatal("extra patterns are not applied without an ignore file")
+	}
+	if err = os.WriteFile(filename, []byte("# comment\n*.log\r\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// extra patterns come last, so they override the file
+	if ig, err = LoadIgnore(filename, "!keep.log"); err != nil {
+		t.Fatal(err)
+	}
+	if !ig.Match("a.log", false) || ig.Match("keep.log", false) {
+		t.Fatal("ignore file and extra patterns are not combined in order")
+	}
+}
+
+func TestArchiveEntries(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"kit.sh", "Mored.yaml", "build/out.bin", "logs/a.log", "docs/readme.md"} {
+		filename := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, excluded, err := archiveEntries(src, ParseIgnore("build/", "*.log", "*.yaml", "!/Mored.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Mored.yaml", "docs", "docs/readme.md", "kit.sh", "logs"}; !slices.Equal(entries, want) {
+		t.Fatalf("entries %q, want %q", entries, want)
+	}
+	// excluded directories are reported once with a trailing slash, their content is not walked
+	if want := []string{"build/", "logs/a.log"}; !slices.Equal(excluded, want) {
+		t.Fatalf("excluded %q, want %q", excluded, want)
+	}
+}
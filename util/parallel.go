@@ -0,0 +1,21 @@
+package util
+
+import "sync"
+
+func Parallel[T any](jobs int, items []T, fc func(T)) {
+	jobs = max(jobs, 1)
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item T) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fc(item)
+		}(item)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const SignatureAlgorithm = "ed25519"
+
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign returns a detached signature of data as "ed25519 <key id> <base64 signature>".
+func Sign(priv ed25519.PrivateKey, data []byte) []byte {
+	sig := ed25519.Sign(priv, data)
+	return []byte(fmt.Sprintf("%s %s %s\n", SignatureAlgorithm, KeyID(priv.Public().(ed25519.PublicKey)), base64.StdEncoding.EncodeToString(sig)))
+}
+func VerifySignature(keys map[string]ed25519.PublicKey, data, signature []byte) (string, error) {
+	fields := strings.Fields(string(signature))
+	if len(fields) != 3 || fields[0] != SignatureAlgorithm {
+		return "", fmt.Errorf("malformed signature")
+	}
+	pub, ok := keys[fields[1]]
+	if !ok {
+		return fields[1], fmt.Errorf("signed by untrusted key %s", fields[1])
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return fields[1], fmt.Errorf("malformed signature: %w", err)
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return fields[1], fmt.Errorf("invalid signature by key %s", fields[1])
+	}
+	return fields[1], nil
+}
+
+func EncodePrivateKey(priv ed25519.PrivateKey) ([]byte, error) {
+	d, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: d}), nil
+}
+func EncodePublicKey(pub ed25519.PublicKey) ([]byte, error) {
+	d, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: d}), nil
+}
+
+// DecodeKey parses a PEM private or public ed25519 key, priv is nil for public keys.
+func DecodeKey(d []byte) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	block, _ := pem.Decode(d)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM data found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("not an ed25519 private key")
+		}
+		return priv, priv.Public().(ed25519.PublicKey), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("not an ed25519 public key")
+		}
+		return nil, pub, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+}
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"cmp"
 	"reflect"
+	"slices"
 	"unicode"
 )
 
@@ -27,3 +29,11 @@ func CamelCaseToUnderscore(s string) string {
 	}
 	return string(output)
 }
+func SortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}